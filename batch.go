@@ -0,0 +1,123 @@
+package mydb
+
+import "sort"
+
+// WriteBatch 批量写，Commit时只加一次锁，所有的操作在一个写事务中原子提交
+// 操作按key排序后执行，相邻的key在同一个叶子页时不用再从根页查找
+// 同一个key的多个操作按添加的顺序执行，WriteBatch不能并发使用
+type WriteBatch struct {
+	db  *DB
+	ops []batchOp
+}
+
+// BatchResult 批量写中每个操作的结果
+type BatchResult struct {
+	IsNew   bool // Set 是否是一个新的记录
+	Deleted bool // Delete 记录是否存在并被删除
+}
+
+// batchOp 批量写中的一个操作
+type batchOp struct {
+	key      []byte
+	value    []byte
+	isDelete bool
+}
+
+// Batch 创建一个批量写
+func (m *DB) Batch() *WriteBatch {
+	return &WriteBatch{db: m}
+}
+
+// Set 添加一个设置操作，key和value会被复制，参数不合法时返回ErrRecordTooLarge
+func (wb *WriteBatch) Set(key, value []byte) error {
+	err := wb.db.checkParam(key, value)
+	if err != nil {
+		return err
+	}
+	wb.ops = append(wb.ops, batchOp{
+		key:   append([]byte(nil), key...),
+		value: append([]byte(nil), value...),
+	})
+	return nil
+}
+
+// Delete 添加一个删除操作，key不存在时不会返回错误，通过BatchResult.Deleted判断
+func (wb *WriteBatch) Delete(key []byte) {
+	wb.ops = append(wb.ops, batchOp{key: append([]byte(nil), key...), isDelete: true})
+}
+
+// Len 操作的数量
+func (wb *WriteBatch) Len() int {
+	return len(wb.ops)
+}
+
+// Reset 清空所有的操作
+func (wb *WriteBatch) Reset() {
+	wb.ops = wb.ops[:0]
+}
+
+// Commit 原子地执行所有的操作，返回的结果和操作添加的顺序一致
+// 成功后清空所有的操作，WriteBatch可以继续使用，失败时所有的操作都会回滚
+func (wb *WriteBatch) Commit() ([]BatchResult, error) {
+	var results []BatchResult
+	err := wb.db.Update(func(tx *Tx) error {
+		var err error
+		results, err = wb.db.tree.batch(wb.ops)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	wb.Reset()
+	return results, nil
+}
+
+// batch 按key的顺序执行ops，叶子页的结构没有变化并且key小于叶子页的上界时，继续使用上一个叶子页
+func (b *tree) batch(ops []batchOp) ([]BatchResult, error) {
+	order := make([]int, len(ops))
+	for i := range order {
+		order[i] = i
+	}
+	// 稳定排序，同一个key的操作保持添加的顺序
+	compare := b.fm.comparator.compare
+	sort.SliceStable(order, func(i, j int) bool {
+		return compare(ops[order[i]].key, ops[order[j]].key) < 0
+	})
+
+	var (
+		results  = make([]BatchResult, len(ops))
+		leafPage *page
+		upper    []byte
+		err      error
+	)
+	for _, i := range order {
+		op := &ops[i]
+		if leafPage == nil || upper != nil && compare(op.key, upper) >= 0 {
+			leafPage, upper, err = b._getLeafPageBound(op.key)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var isChanged bool
+		if op.isDelete {
+			if leafPage != nil {
+				results[i].Deleted, isChanged, err = b._deleteFromLeaf(leafPage, op.key)
+			}
+		} else {
+			var r *record
+			r, err = b.newRecord(op.key, op.value)
+			if err == nil {
+				results[i].IsNew, isChanged, err = b._putToLeaf(leafPage, r)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 树的结构变化之后需要重新从根页查找
+		if isChanged {
+			leafPage = nil
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,121 @@
+package mydb
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestWriteBatch(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	for i := 0; i < 1000; i += 2 {
+		_, _ = db.Set(toBytes(i), toBytes(i))
+	}
+
+	wb := db.Batch()
+	expect := make(map[int][]byte)
+	for i := 0; i < 1000; i += 2 {
+		expect[i] = toBytes(i)
+	}
+	var expectResults []BatchResult
+	for _, i := range rand.Perm(2000) {
+		_, ok := expect[i%1000]
+		if i%3 == 0 {
+			wb.Delete(toBytes(i % 1000))
+			delete(expect, i%1000)
+			expectResults = append(expectResults, BatchResult{Deleted: ok})
+		} else {
+			value := toBytes(i)
+			if i%100 == 1 {
+				value = largeValue(i, 10000)
+			}
+			if err := wb.Set(toBytes(i%1000), value); err != nil {
+				t.Fatal(err)
+			}
+			expect[i%1000] = value
+			expectResults = append(expectResults, BatchResult{IsNew: !ok})
+		}
+	}
+	if wb.Len() != 2000 {
+		t.Fatal(wb.Len())
+	}
+
+	results, err := wb.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wb.Len() != 0 {
+		t.Fatal(wb.Len())
+	}
+	for i := range results {
+		if results[i] != expectResults[i] {
+			t.Fatal(i, results[i], expectResults[i])
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		value, err := db.Get(toBytes(i))
+		if expect[i] == nil {
+			if err != ErrRecordNotExist {
+				t.Fatal(i, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(value, expect[i]) {
+			t.Fatal(i, len(value), err)
+		}
+	}
+	checkTree(t, db.tree)
+}
+
+func TestWriteBatch_sameKey(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	wb := db.Batch()
+	_ = wb.Set(toBytes(2), toBytes(1))
+	wb.Delete(toBytes(1))
+	_ = wb.Set(toBytes(1), toBytes(1))
+	_ = wb.Set(toBytes(1), toBytes(2))
+	wb.Delete(toBytes(2))
+	results, err := wb.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []BatchResult{{IsNew: true}, {}, {IsNew: true}, {}, {Deleted: true}}
+	for i := range expect {
+		if results[i] != expect[i] {
+			t.Fatal(i, results[i])
+		}
+	}
+	if value, _ := db.Get(toBytes(1)); string(value) != "2" {
+		t.Fatal(string(value))
+	}
+	if _, err = db.Get(toBytes(2)); err != ErrRecordNotExist {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteBatch_error(t *testing.T) {
+	db := newDefaultDB()
+
+	wb := db.Batch()
+	if err := wb.Set(bytes.Repeat([]byte{1}, 3000), toBytes(1)); err != ErrRecordTooLarge {
+		t.Fatal(err)
+	}
+	if wb.Len() != 0 {
+		t.Fatal(wb.Len())
+	}
+
+	_ = wb.Set(toBytes(1), toBytes(1))
+	_ = db.Close()
+	if _, err := wb.Commit(); err != ErrClosed {
+		t.Fatal(err)
+	}
+	if wb.Len() != 1 {
+		t.Fatal(wb.Len())
+	}
+}
@@ -0,0 +1,186 @@
+package mydb
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	ErrFileExists = errors.New("error file already exists")
+	ErrUnsorted   = errors.New("error keys not in ascending order")
+)
+
+// Iterator BulkLoad的数据源，按key从小到大返回键值对
+// Next返回false表示遍历结束，如果是出错结束，Err返回错误
+type Iterator interface {
+	Next() (key, value []byte, ok bool)
+	Err() error
+}
+
+// kvIterator 遍历[]KV的Iterator
+type kvIterator struct {
+	kvs []KV
+}
+
+// NewKVIterator 遍历kvs的Iterator，比如从Range的结果重建数据库
+func NewKVIterator(kvs []KV) Iterator {
+	return &kvIterator{kvs: kvs}
+}
+
+func (it *kvIterator) Next() (key, value []byte, ok bool) {
+	if len(it.kvs) == 0 {
+		return nil, nil, false
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv.Key, kv.Value, true
+}
+
+func (it *kvIterator) Err() error {
+	return nil
+}
+
+// BulkLoad 用按key严格递增的数据创建一个新的数据库文件，文件已经存在时返回ErrFileExists
+// 不经过tree.set，从叶子页开始自底向上构建：叶子页按WithFillFactor填充，页满时开始新的页，
+// 新页的最小key写入上一层的枝干页，最后把最上层的页设为根页，整个过程只遍历一次数据
+// 导入时直接修改映射，不写wal，完成后一次刷盘；出错时删除已经创建的文件
+func BulkLoad(fileName string, iter Iterator, opts ...Option) (err error) {
+	if _, err = os.Stat(fileName); err == nil {
+		return ErrFileExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	options := getOptions(opts...)
+	fm, err := newFileManager(fileName, options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = fm.release()
+			_ = os.Remove(fileName)
+			_ = os.Remove(fileName + ".wal")
+		}
+	}()
+
+	loader, err := newBulkLoader(newTree(fm), options.fillFactor)
+	if err != nil {
+		return err
+	}
+	var last []byte
+	for num := 0; ; num++ {
+		key, value, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if num > 0 && options.comparator.compare(key, last) <= 0 {
+			return ErrUnsorted
+		}
+		last = append(last[:0], key...)
+
+		err = loader.add(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return err
+	}
+
+	loader.finish()
+	return fm.close()
+}
+
+// bulkLoader 自底向上构建树，每一层只保留最后一个页
+type bulkLoader struct {
+	tree     *tree
+	fillSize uint32  // 按填充因子每页可以使用的空间
+	levels   []*page // levels[0]是叶子层，每一层正在写入的页
+	used     []uint32
+}
+
+func newBulkLoader(tree *tree, fillFactor float64) (*bulkLoader, error) {
+	// 新文件只有一个空的根页，作为第一个叶子页
+	root, err := tree.fm.rootPage()
+	if err != nil {
+		return nil, err
+	}
+	return &bulkLoader{
+		tree:     tree,
+		fillSize: uint32(float64(root.capacity()) * fillFactor),
+		levels:   []*page{root},
+		used:     []uint32{0},
+	}, nil
+}
+
+func (l *bulkLoader) add(key, value []byte) error {
+	err := l.tree.checkParam(key, value)
+	if err != nil {
+		return err
+	}
+	r, err := l.tree.newRecord(key, value)
+	if err != nil {
+		return err
+	}
+	return l._add(0, r)
+}
+
+// _add 将r追加到level层正在写入的页，页满时申请新的页，并把新页添加到上一层
+func (l *bulkLoader) _add(level int, r *record) error {
+	page := l.levels[level]
+	need := r.needSpaceLen(page.width) + page.width
+	if l.used[level] == 0 || l.used[level]+need <= l.fillSize {
+		_, isEnoughSpace := page.setRecord(r)
+		if isEnoughSpace {
+			l.used[level] += need
+			return nil
+		}
+		// checkParam保证了空页一定可以放下一条记录
+		if l.used[level] == 0 {
+			return ErrRecordTooLarge
+		}
+	}
+
+	pageType := uint16(pageTypeBranch)
+	if level == 0 {
+		pageType = pageTypeLeaf
+	}
+	newPage, err := l.tree.fm.allocatePage(pageType)
+	if err != nil {
+		return err
+	}
+	newPage.setRecord(r)
+	// 只有叶子页需要串联，枝干页中子页的父节点由下一层设置
+	if level == 0 {
+		page.setNext(newPage.offset)
+		newPage.setPre(page.offset)
+	}
+	l.levels[level] = newPage
+	l.used[level] = need
+
+	// 第一次分裂时创建上一层，上一层的第一条记录指向之前的页
+	if level+1 == len(l.levels) {
+		parent, err := l.tree.fm.allocatePage(pageTypeBranch)
+		if err != nil {
+			return err
+		}
+		first := &record{Key: page.min(), Value: page.offsetBuf()}
+		parent.setRecord(first)
+		page.setParent(parent.offset)
+		l.levels = append(l.levels, parent)
+		l.used = append(l.used, first.needSpaceLen(parent.width)+parent.width)
+	}
+	err = l._add(level+1, &record{Key: r.Key, Value: newPage.offsetBuf()})
+	if err != nil {
+		return err
+	}
+	newPage.setParent(l.levels[level+1].offset)
+	return nil
+}
+
+// finish 最上层的页就是根页，第一个叶子页一直是front
+func (l *bulkLoader) finish() {
+	root := l.levels[len(l.levels)-1]
+	l.tree.fm.setRoot(root.offset)
+}
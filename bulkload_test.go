@@ -0,0 +1,111 @@
+package mydb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func bulkLoadKVs(n int) []KV {
+	kvs := make([]KV, n)
+	for i := range kvs {
+		kvs[i].Key = []byte(fmt.Sprintf("%08d", i))
+		kvs[i].Value = kvs[i].Key
+		if i%1000 == 1 {
+			kvs[i].Value = largeValue(i, 10000)
+		}
+	}
+	return kvs
+}
+
+func TestBulkLoad(t *testing.T) {
+	kvs := bulkLoadKVs(100000)
+	for _, fillFactor := range []float64{0.5, 1} {
+		os.Remove("data")
+		os.Remove("data.wal")
+		err := BulkLoad("data", NewKVIterator(kvs), WithFillFactor(fillFactor))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := Open("data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, db.tree)
+		all, err := db.Range(Infinity, Infinity)
+		if err != nil || len(all) != len(kvs) {
+			t.Fatal(len(all), err)
+		}
+		for i := range kvs {
+			if !bytes.Equal(all[i].Key, kvs[i].Key) || !bytes.Equal(all[i].Value, kvs[i].Value) {
+				t.Fatal(i)
+			}
+		}
+		result, _ := db.tree.fm.statisticsPage()
+		t.Log(fillFactor, result)
+
+		// 导入之后可以正常读写
+		err = db.Update(func(tx *Tx) error {
+			for i := 0; i+1 < len(kvs); i += 3 {
+				if err := tx.Delete(kvs[i].Key); err != nil {
+					return err
+				}
+				if _, err := tx.Set([]byte(string(kvs[i+1].Key)+"x"), kvs[i+1].Key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, db.tree)
+		value, err := db.Get(kvs[1001].Key)
+		if err != nil || !bytes.Equal(value, kvs[1001].Value) {
+			t.Fatal(len(value), err)
+		}
+		_ = db.Close()
+	}
+}
+
+func TestBulkLoad_empty(t *testing.T) {
+	os.Remove("data")
+	os.Remove("data.wal")
+	if err := BulkLoad("data", NewKVIterator(nil)); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if kvs, err := db.Range(Infinity, Infinity); err != nil || len(kvs) != 0 {
+		t.Fatal(kvs, err)
+	}
+}
+
+func TestBulkLoad_error(t *testing.T) {
+	os.Remove("data")
+	os.Remove("data.wal")
+	kvs := bulkLoadKVs(10000)
+	kvs[5000], kvs[5001] = kvs[5001], kvs[5000]
+	if err := BulkLoad("data", NewKVIterator(kvs)); err != ErrUnsorted {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("data"); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	kvs[5000].Key = bytes.Repeat([]byte{1}, 5000)
+	if err := BulkLoad("data", NewKVIterator(kvs[5000:])); err != ErrRecordTooLarge {
+		t.Fatal(err)
+	}
+
+	db := newDefaultDB()
+	_ = db.Close()
+	if err := BulkLoad("data", NewKVIterator(kvs)); err != ErrFileExists {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,324 @@
+package mydb
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// compactBatchPageNum 每个事务最多移动的页数量，事务之间会释放锁，读请求可以继续执行
+const compactBatchPageNum = 1024
+
+// Compact 将文件末尾的页移动到前面被回收的页中，然后截断文件
+// 分成多个写事务执行，每个事务提交后文件就会变小，中途出错时已经提交的部分仍然有效
+func (m *DB) Compact() error {
+	for {
+		done, err := m.compact()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (m *DB) compact() (bool, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.closed {
+		return false, ErrClosed
+	}
+	return m.tree.compact(compactBatchPageNum)
+}
+
+type pageMove struct {
+	from uint64
+	to   uint64
+}
+
+// compactPlan 一次压缩的计划，在事务开始前只读地计算出来
+type compactPlan struct {
+	moves   []pageMove
+	removed map[uint64]struct{} // 需要从回收链表中移除的页
+	end     uint64              // 压缩后的文件大小
+	done    bool                // 是否已经不能再压缩
+}
+
+// compact 最多移动maxPageNum个页，返回是否已经压缩完成
+func (b *tree) compact(maxPageNum int) (bool, error) {
+	recycled, err := b.fm.recycledPages()
+	if err != nil {
+		return false, err
+	}
+	plan, err := b._compactPlan(recycled, maxPageNum)
+	if err != nil {
+		return false, err
+	}
+	if plan.end == uint64(b.fm.size) {
+		return true, nil
+	}
+
+	// 移动溢出链表的第一个页时，需要通过key找到指向它的记录
+	var heads map[uint64][]byte
+	for _, move := range plan.moves {
+		page, err := b.fm.page(move.from)
+		if err != nil {
+			return false, err
+		}
+		if page.pageType() == pageTypeOverflow && page.pre() == 0 {
+			heads, err = b._overflowHeads()
+			if err != nil {
+				return false, err
+			}
+			break
+		}
+	}
+
+	b.fm.begin()
+	for _, move := range plan.moves {
+		err = b._movePage(move.from, move.to, heads)
+		if err != nil {
+			b.fm.rollback()
+			return false, err
+		}
+	}
+	err = b.fm.unlinkRecycled(recycled, plan.removed)
+	if err != nil {
+		b.fm.rollback()
+		return false, err
+	}
+	b.fm.tx.size = int64(plan.end)
+	err = b.fm.commit()
+	if err != nil {
+		return false, err
+	}
+	return plan.done, nil
+}
+
+// _compactPlan 从文件末尾开始，回收的页直接截掉，使用中的页移动到最前面的回收页
+func (b *tree) _compactPlan(recycled []uint64, maxPageNum int) (*compactPlan, error) {
+	isRecycled := make(map[uint64]struct{}, len(recycled))
+	for _, offset := range recycled {
+		isRecycled[offset] = struct{}{}
+	}
+	slots := append([]uint64(nil), recycled...)
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+
+	plan := &compactPlan{
+		removed: make(map[uint64]struct{}),
+		end:     uint64(b.fm.size),
+	}
+	targets := make(map[uint64]struct{})
+	for {
+		if len(plan.moves) >= maxPageNum {
+			return plan, nil
+		}
+
+		last := plan.end - b.fm.pageSize
+		// 已经是移动的目标页，前面没有空闲的页了
+		if _, ok := targets[last]; ok {
+			plan.done = true
+			return plan, nil
+		}
+		if _, ok := isRecycled[last]; ok {
+			plan.removed[last] = struct{}{}
+			plan.end = last
+			continue
+		}
+		page, err := b.fm.page(last)
+		if err != nil {
+			return nil, err
+		}
+		// 不在回收链表中的回收页，没有任何地方引用，也可以直接截掉
+		if page.pageType() == pageTypeRecycle {
+			plan.end = last
+			continue
+		}
+
+		for len(slots) > 0 {
+			if _, ok := plan.removed[slots[0]]; !ok {
+				break
+			}
+			slots = slots[1:]
+		}
+		if len(slots) == 0 || slots[0] >= last {
+			plan.done = true
+			return plan, nil
+		}
+
+		plan.moves = append(plan.moves, pageMove{from: last, to: slots[0]})
+		plan.removed[slots[0]] = struct{}{}
+		targets[slots[0]] = struct{}{}
+		slots = slots[1:]
+		plan.end = last
+	}
+}
+
+// _movePage 将from页的内容复制到to页，并修改所有指向from页的指针
+func (b *tree) _movePage(from, to uint64, heads map[uint64][]byte) error {
+	src, err := b.fm.page(from)
+	if err != nil {
+		return err
+	}
+	page := b.fm.loadPage(b.fm.pageBuf(to), to)
+	copy(page.buf, src.buf)
+
+	switch page.pageType() {
+	case pageTypeBranch, pageTypeLeaf:
+		err = b._moveTreePage(from, page)
+	case pageTypeOverflow:
+		err = b._moveOverflowPage(from, page, heads)
+	default:
+		err = b.fm.corrupted(from)
+	}
+	return err
+}
+
+func (b *tree) _moveTreePage(from uint64, page *page) error {
+	// 修改父页中的指针
+	if page.parent() == 0 {
+		if binary.BigEndian.Uint64(b.fm.meta()[rootBegin:]) != from {
+			return b.fm.corrupted(from)
+		}
+		b.fm.setRoot(page.offset)
+	} else {
+		parent, err := b.fm.page(page.parent())
+		if err != nil {
+			return err
+		}
+		records, index, err := b._childIndex(parent, from)
+		if err != nil {
+			return err
+		}
+		records[index].Value = page.offsetBuf()
+		parent.setRecord(records[index])
+	}
+
+	if page.pageType() == pageTypeBranch {
+		return b._setParent(page.all(), page.offset)
+	}
+	return b._relink(from, page)
+}
+
+func (b *tree) _moveOverflowPage(from uint64, page *page, heads map[uint64][]byte) error {
+	if page.pre() != 0 {
+		return b._relink(from, page)
+	}
+
+	// 溢出链表的第一个页，修改叶子页记录中的溢出页指针
+	key, ok := heads[from]
+	if !ok {
+		return b.fm.corrupted(from)
+	}
+	leafPage, err := b._getLeafPage(key)
+	if err != nil {
+		return err
+	}
+	if leafPage == nil {
+		return b.fm.corrupted(from)
+	}
+	r := leafPage.getRecord(key)
+	if r == nil || !r.isOverflow || binary.BigEndian.Uint64(r.Value) != from {
+		return b.fm.corrupted(from)
+	}
+	binary.BigEndian.PutUint64(r.Value, page.offset)
+	leafPage.setRecord(r)
+	heads[page.offset] = key
+	return b._relink(from, page)
+}
+
+// _relink 修改前后页中指向from页的指针，from是front时修改front
+func (b *tree) _relink(from uint64, page *page) error {
+	if page.pre() != 0 {
+		pre, err := b.fm.page(page.pre())
+		if err != nil {
+			return err
+		}
+		pre.setNext(page.offset)
+	} else if page.pageType() == pageTypeLeaf {
+		b.fm.setFront(page.offset)
+	}
+
+	if page.next() != 0 {
+		next, err := b.fm.page(page.next())
+		if err != nil {
+			return err
+		}
+		next.setPre(page.offset)
+	}
+	return nil
+}
+
+// _overflowHeads 所有溢出链表的第一个页对应的key
+func (b *tree) _overflowHeads() (map[uint64][]byte, error) {
+	heads := make(map[uint64][]byte)
+	page, err := b.fm.frontPage()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for _, r := range page.all() {
+			if r.isOverflow {
+				heads[binary.BigEndian.Uint64(r.Value)] = r.Key
+			}
+		}
+
+		if page.next() == 0 {
+			return heads, nil
+		}
+		page, err = b.fm.page(page.next())
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// recycledPages 按链表顺序返回所有被回收的页
+func (f *fileManager) recycledPages() ([]uint64, error) {
+	var offsets []uint64
+	offset := binary.BigEndian.Uint64(f.meta()[recycleBegin:])
+	for offset != 0 {
+		page, err := f.page(offset)
+		if err != nil {
+			return nil, err
+		}
+		if page.pageType() != pageTypeRecycle || len(offsets) > int(f.size/f.pageSizeInt64) {
+			return nil, f.corrupted(offset)
+		}
+		offsets = append(offsets, offset)
+		offset = page.next()
+	}
+	return offsets, nil
+}
+
+// unlinkRecycled 从回收链表中移除removed中的页，只修改next发生变化的页
+// recycled是recycledPages返回的链表顺序，recycled[i+1]就是recycled[i]当前的next
+func (f *fileManager) unlinkRecycled(recycled []uint64, removed map[uint64]struct{}) error {
+	keep := make([]int, 0, len(recycled))
+	for i, offset := range recycled {
+		if _, ok := removed[offset]; !ok {
+			keep = append(keep, i)
+		}
+	}
+
+	head := uint64(0)
+	if len(keep) > 0 {
+		head = recycled[keep[0]]
+	}
+	binary.BigEndian.PutUint64(f.meta()[recycleBegin:], head)
+
+	for i, index := range keep {
+		next := uint64(0)
+		if i+1 < len(keep) {
+			next = recycled[keep[i+1]]
+		}
+		if index+1 < len(recycled) && recycled[index+1] == next || index+1 == len(recycled) && next == 0 {
+			continue
+		}
+
+		page, err := f.page(recycled[index])
+		if err != nil {
+			return err
+		}
+		page.setNext(next)
+	}
+	return nil
+}
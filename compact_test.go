@@ -0,0 +1,170 @@
+package mydb
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDB_Compact(t *testing.T) {
+	seed := time.Now().Unix()
+	t.Log("seed", seed)
+	rand.Seed(seed)
+
+	db := newDefaultDB()
+	defer db.Close()
+
+	const count = 20000
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%8d", i)) }
+	err := db.Update(func(tx *Tx) error {
+		for i := 0; i < count; i++ {
+			value := key(i)
+			if i%1000 == 0 {
+				value = largeValue(i, 10000)
+			}
+			if _, err := tx.Set(key(i), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := make(map[int]bool)
+	err = db.Update(func(tx *Tx) error {
+		for _, i := range rand.Perm(count)[:count*9/10] {
+			deleted[i] = true
+			if err := tx.Delete(key(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := db.tree.fm.statisticsPage()
+
+	// 压缩的同时读取
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			i := rand.Intn(count)
+			value, err := db.Get(key(i))
+			if deleted[i] {
+				if err != ErrRecordNotExist {
+					t.Error(i, err)
+					return
+				}
+			} else if err != nil || len(value) == 0 {
+				t.Error(i, err)
+				return
+			}
+		}
+	}()
+	err = db.Compact()
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, _ := db.tree.fm.statisticsPage()
+	t.Log(before)
+	t.Log(after)
+	if after.fileSize >= before.fileSize || after.recyclePageNum > before.recyclePageNum/10 {
+		t.Fatal(after)
+	}
+	checkTree(t, db.tree)
+
+	check := func() {
+		for i := 0; i < count; i++ {
+			value, err := db.Get(key(i))
+			if deleted[i] {
+				if err != ErrRecordNotExist {
+					t.Fatal(i, err)
+				}
+				continue
+			}
+			want := key(i)
+			if i%1000 == 0 {
+				want = largeValue(i, 10000)
+			}
+			if err != nil || !bytes.Equal(value, want) {
+				t.Fatal(i, err)
+			}
+		}
+	}
+	check()
+
+	// 重新打开后数据不变，再次压缩不会有变化
+	_ = db.Close()
+	db, err = Open("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check()
+	if err = db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := db.tree.fm.statisticsPage(); result.fileSize != after.fileSize {
+		t.Fatal(result)
+	}
+}
+
+func Test_tree_compact(t *testing.T) {
+	seed := time.Now().Unix()
+	t.Log("seed", seed)
+	rand.Seed(seed)
+
+	tree := newDefaultTree()
+	defer tree.fm.close()
+	mock := newRecordList()
+
+	for i := 0; i < 50000; i++ {
+		key := toBytes(rand.Intn(10000))
+		switch rand.Intn(3) {
+		case 0, 1:
+			value := toBytes(rand.Intn(10000))
+			if rand.Intn(100) == 0 {
+				value = largeValue(i, 5000+rand.Intn(10000))
+			}
+			tree.set(key, value)
+			mock.set(&record{Key: key, Value: value})
+		case 2:
+			tree.delete(key)
+			mock.delete(key)
+		}
+	}
+
+	for {
+		done, err := tree.compact(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, tree)
+		if done {
+			break
+		}
+	}
+	mock.assertMatch(t, tree.mustAll(), nil)
+	result, _ := tree.fm.statisticsPage()
+	t.Log(result)
+	if result.recyclePageNum != 0 {
+		t.Fatal(result)
+	}
+}
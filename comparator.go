@@ -0,0 +1,37 @@
+package mydb
+
+import (
+	"bytes"
+	"errors"
+)
+
+var ErrComparatorMismatch = errors.New("error comparator mismatch")
+
+// maxComparatorNameLen 比较器名字的最大长度
+const maxComparatorNameLen = 64
+
+// comparator key的比较器，名字保存在文件头中，打开文件时必须使用同一个比较器
+// 默认比较器按字节比较，名字为空，没有比较器名字的旧文件使用的都是默认比较器
+type comparator struct {
+	name    string
+	compare func(a, b []byte) int
+}
+
+var defaultComparator = comparator{compare: bytes.Compare}
+
+// WithComparator 设置key的比较器,默认按字节比较
+// compare返回负数、0、正数分别表示a小于、等于、大于b，比较结果为0的key是同一个key
+// name用来识别比较器，保存在文件头中，用不同名字的比较器打开文件会返回ErrComparatorMismatch
+// 同一个名字的比较器必须始终保持相同的顺序，否则数据会错乱
+func WithComparator(name string, compare func(a, b []byte) int) Option {
+	if name == "" || len(name) > maxComparatorNameLen {
+		panic("comparator name must not be empty and length must less or equal to 64")
+	}
+	if compare == nil {
+		panic("compare must not be nil")
+	}
+
+	return newFuncServerOption(func(o *options) {
+		o.comparator = comparator{name: name, compare: compare}
+	})
+}
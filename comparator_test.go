@@ -0,0 +1,162 @@
+package mydb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// int64Comparator 按大端有符号整数比较
+func int64Comparator(a, b []byte) int {
+	x, y := int64(binary.BigEndian.Uint64(a)), int64(binary.BigEndian.Uint64(b))
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func int64Key(i int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(i))
+	return key
+}
+
+func newComparatorDB(name string, compare func(a, b []byte) int) (*DB, error) {
+	os.Remove("data")
+	os.Remove("data.wal")
+	return Open("data", WithComparator(name, compare))
+}
+
+func TestWithComparator(t *testing.T) {
+	db := newDefaultDB()
+	_ = db.Close()
+	_, err := Open("data", WithComparator("int64", int64Comparator))
+	if !errors.Is(err, ErrComparatorMismatch) {
+		t.Fatal(err)
+	}
+
+	db, err = newComparatorDB("int64", int64Comparator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 新文件的比较器名字保存在文件头中
+	if db.tree.fm.header().comparator != "int64" {
+		t.Fatal(db.tree.fm.header())
+	}
+	_ = db.Close()
+
+	for _, opts := range [][]Option{nil, {WithComparator("int32", int64Comparator)}} {
+		_, err = Open("data", opts...)
+		if !errors.Is(err, ErrComparatorMismatch) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWithComparator_int64(t *testing.T) {
+	db, err := newComparatorDB("int64", int64Comparator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &recordList{compare: int64Comparator}
+	err = db.Update(func(tx *Tx) error {
+		for _, i := range rand.Perm(20000) {
+			key := int64Key(int64(i - 10000))
+			mock.set(&record{Key: key, Value: key})
+			if _, err := tx.Set(key, key); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < 20000; i += 3 {
+			key := int64Key(int64(i - 10000))
+			mock.delete(key)
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, db.tree)
+
+	records, err := db.tree.all()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.assertMatch(t, records, nil)
+
+	kvs, err := db.Range(int64Key(-10), int64Key(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expect []*record
+	for _, r := range mock.list {
+		if r.match(int64Key(-10), int64Key(10), int64Comparator) {
+			expect = append(expect, r)
+		}
+	}
+	newRecordList(expect).assertMatch(t, kvsToRecords(kvs), nil)
+
+	_ = db.View(func(tx *Tx) error {
+		// -10000已经被删除
+		k, _ := tx.Cursor().Seek(int64Key(-10000))
+		if !bytes.Equal(k, int64Key(-9999)) {
+			t.Fatal(k)
+		}
+		return nil
+	})
+	_ = db.Close()
+
+	// 重新打开后顺序不变
+	db, err = Open("data", WithComparator("int64", int64Comparator))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, err := db.Get(int64Key(-9999))
+	if err != nil || !bytes.Equal(value, int64Key(-9999)) {
+		t.Fatal(value, err)
+	}
+}
+
+func TestWithComparator_caseInsensitive(t *testing.T) {
+	db, err := newComparatorDB("case-insensitive", func(a, b []byte) int {
+		return bytes.Compare(bytes.ToLower(a), bytes.ToLower(b))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, _ = db.Set([]byte("b"), toBytes(1))
+	_, _ = db.Set([]byte("A"), toBytes(2))
+	isNew, _ := db.Set([]byte("B"), toBytes(3))
+	if isNew {
+		t.Fatal(isNew)
+	}
+
+	kvs, _ := db.Range(Infinity, Infinity)
+	if len(kvs) != 2 || string(kvs[0].Key) != "A" || string(kvs[1].Key) != "B" || string(kvs[1].Value) != "3" {
+		t.Fatal(kvs)
+	}
+	if value, err := db.Get([]byte("a")); err != nil || string(value) != "2" {
+		t.Fatal(value, err)
+	}
+}
+
+func kvsToRecords(kvs []KV) []*record {
+	records := make([]*record, len(kvs))
+	for i := range kvs {
+		records[i] = &record{Key: kvs[i].Key, Value: kvs[i].Value}
+	}
+	return records
+}
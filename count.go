@@ -0,0 +1,315 @@
+package mydb
+
+import (
+	"bytes"
+	"math"
+)
+
+// Count 返回[min, max]之间的记录数，min或max为Infinity表示这一边没有边界
+// 两端的叶子页在目录中二分查找，中间的叶子页直接取目录中的slot数，不读取记录
+func (m *DB) Count(min, max []byte) (num int, err error) {
+	err = m.View(func(tx *Tx) error {
+		num, err = tx.Count(min, max)
+		return err
+	})
+	return
+}
+
+func (tx *Tx) Count(min, max []byte) (int, error) {
+	err := tx.check(false)
+	if err != nil {
+		return 0, err
+	}
+	return tx.db.tree.countRange(min, max)
+}
+
+// ApproximateCount 估算[min, max]之间的记录数，不读取中间的叶子页：
+// 叶子页数从枝干页的扇出得到，每页的记录数按两端的叶子页估算，叶子页越均匀结果越准确
+func (m *DB) ApproximateCount(min, max []byte) (num int, err error) {
+	err = m.View(func(tx *Tx) error {
+		num, err = tx.ApproximateCount(min, max)
+		return err
+	})
+	return
+}
+
+func (tx *Tx) ApproximateCount(min, max []byte) (int, error) {
+	err := tx.check(false)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.db.tree.estimate(min, max)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(result.records)), nil
+}
+
+// ApproximateSize 估算[min, max]之间的记录占用的叶子页空间，单位字节，估算方法和ApproximateCount相同
+// 不包括存储在溢出页中的value
+func (m *DB) ApproximateSize(min, max []byte) (size int64, err error) {
+	err = m.View(func(tx *Tx) error {
+		size, err = tx.ApproximateSize(min, max)
+		return err
+	})
+	return
+}
+
+func (tx *Tx) ApproximateSize(min, max []byte) (int64, error) {
+	err := tx.check(false)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.db.tree.estimate(min, max)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(result.leaves * float64(tx.db.tree.fm.pageSize))), nil
+}
+
+// countRange 沿着叶子页链表统计slot数，只有两端的页需要二分查找
+func (b *tree) countRange(min, max []byte) (int, error) {
+	var page *page
+	var err error
+	index := 0
+	if !bytes.Equal(min, Infinity) {
+		page, err = b._getLeafPage(min)
+		if err != nil {
+			return 0, err
+		}
+		if page != nil {
+			index, _ = page._dirSearch(min)
+		}
+	}
+	if page == nil {
+		page, err = b.fm.frontPage()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	hasMax := !bytes.Equal(max, Infinity)
+	num := 0
+	for {
+		end := page._dirNum()
+		if hasMax && end > 0 && b.fm.comparator.compare(page._key(page._slot(end-1)), max) > 0 {
+			var found bool
+			end, found = page._dirSearch(max)
+			if found {
+				end++
+			}
+			if end > index {
+				num += end - index
+			}
+			return num, nil
+		}
+		num += end - index
+
+		if page.next() == 0 {
+			return num, nil
+		}
+		page, err = b.fm.page(page.next())
+		if err != nil {
+			return 0, err
+		}
+		index = 0
+	}
+}
+
+// bound 范围的一端在树中的位置
+type bound struct {
+	path  []int // 从根页到叶子页，每个枝干页中走的子页下标
+	index int   // 在叶子页目录中的下标，之前的记录在范围外
+	num   int   // 叶子页的记录数
+}
+
+// estimation 估算的结果，records是记录数，leaves是叶子页数，都可以是小数
+type estimation struct {
+	records float64
+	leaves  float64
+}
+
+// estimate 估算[min, max]之间的记录数和叶子页数
+// 两端叶子页中的部分按下标精确计算，中间的叶子页数从两条路径之间的枝干页统计
+func (b *tree) estimate(min, max []byte) (estimation, error) {
+	lower, err := b._bound(min, false)
+	if err != nil {
+		return estimation{}, err
+	}
+	upper, err := b._bound(max, true)
+	if err != nil {
+		return estimation{}, err
+	}
+
+	order := 0
+	for i := range lower.path {
+		if lower.path[i] != upper.path[i] {
+			order = lower.path[i] - upper.path[i]
+			break
+		}
+	}
+	if order > 0 {
+		return estimation{}, nil
+	}
+	if order == 0 {
+		// 在同一个叶子页
+		if lower.index >= upper.index {
+			return estimation{}, nil
+		}
+		records := float64(upper.index - lower.index)
+		return estimation{records: records, leaves: records / float64(upper.num)}, nil
+	}
+
+	root, err := b.fm.rootPage()
+	if err != nil {
+		return estimation{}, err
+	}
+	between, err := b._leavesBetween(root, lower.path, upper.path)
+	if err != nil {
+		return estimation{}, err
+	}
+	var result estimation
+	result.records = float64(lower.num-lower.index+upper.index) + float64(between)*float64(lower.num+upper.num)/2
+	result.leaves = float64(between)
+	if lower.num > 0 {
+		result.leaves += float64(lower.num-lower.index) / float64(lower.num)
+	}
+	if upper.num > 0 {
+		result.leaves += float64(upper.index) / float64(upper.num)
+	}
+	return result, nil
+}
+
+// _bound 从根页走到key所在的叶子页，isMax表示key是范围的右端，等于key的记录在范围内
+// key是Infinity时，左端走到第一个叶子页的开头，右端走到最后一个叶子页的末尾
+func (b *tree) _bound(key []byte, isMax bool) (bound, error) {
+	isInfinity := bytes.Equal(key, Infinity)
+	var result bound
+	page, err := b.fm.rootPage()
+	if err != nil {
+		return bound{}, err
+	}
+	for page.pageType() != pageTypeLeaf {
+		num := page._dirNum()
+		if num == 0 {
+			return bound{}, b.fm.corrupted(page.offset)
+		}
+		// key小于所有分隔key时走第一个子页
+		index := 0
+		if isInfinity && isMax {
+			index = num - 1
+		} else if !isInfinity {
+			i, found := page._dirSearch(key)
+			index = i
+			if !found && index > 0 {
+				index--
+			}
+		}
+		result.path = append(result.path, index)
+
+		page, err = b.fm.page(page._child(index))
+		if err != nil {
+			return bound{}, err
+		}
+	}
+
+	result.num = page._dirNum()
+	if isInfinity && isMax {
+		result.index = result.num
+	} else if !isInfinity {
+		var found bool
+		result.index, found = page._dirSearch(key)
+		if found && isMax {
+			result.index++
+		}
+	}
+	return result, nil
+}
+
+// _leavesBetween 统计page下lower和upper两条路径之间的叶子页数，不包括两端的叶子页
+// lower或upper为nil表示这一边没有边界，只读取枝干页
+func (b *tree) _leavesBetween(page *page, lower, upper []int) (int, error) {
+	// 两条路径还没有分开
+	if lower != nil && upper != nil && lower[0] == upper[0] && len(lower) > 1 {
+		child, err := b.fm.page(page._child(lower[0]))
+		if err != nil {
+			return 0, err
+		}
+		return b._leavesBetween(child, lower[1:], upper[1:])
+	}
+
+	begin, end := 0, page._dirNum()-1
+	if lower != nil {
+		begin = lower[0] + 1
+	}
+	if upper != nil {
+		end = upper[0] - 1
+	}
+	// 子页是叶子页，两端的叶子页不算在内
+	height := len(lower)
+	if lower == nil {
+		height = len(upper)
+	}
+	if height == 1 {
+		if end < begin {
+			return 0, nil
+		}
+		return end - begin + 1, nil
+	}
+
+	num := 0
+	if lower != nil {
+		child, err := b.fm.page(page._child(lower[0]))
+		if err != nil {
+			return 0, err
+		}
+		n, err := b._leavesBetween(child, lower[1:], nil)
+		if err != nil {
+			return 0, err
+		}
+		num += n
+	}
+	if upper != nil {
+		child, err := b.fm.page(page._child(upper[0]))
+		if err != nil {
+			return 0, err
+		}
+		n, err := b._leavesBetween(child, nil, upper[1:])
+		if err != nil {
+			return 0, err
+		}
+		num += n
+	}
+	for i := begin; i <= end; i++ {
+		child, err := b.fm.page(page._child(i))
+		if err != nil {
+			return 0, err
+		}
+		n, err := b._leafNum(child, height-1)
+		if err != nil {
+			return 0, err
+		}
+		num += n
+	}
+	return num, nil
+}
+
+// _leafNum page下的叶子页数，height是page到叶子页的层数
+func (b *tree) _leafNum(page *page, height int) (int, error) {
+	if height == 1 {
+		return page._dirNum(), nil
+	}
+	num := 0
+	for i := 0; i < page._dirNum(); i++ {
+		child, err := b.fm.page(page._child(i))
+		if err != nil {
+			return 0, err
+		}
+		n, err := b._leafNum(child, height-1)
+		if err != nil {
+			return 0, err
+		}
+		num += n
+	}
+	return num, nil
+}
@@ -0,0 +1,86 @@
+package mydb
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	// 0,2,4...
+	const count = 50000
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("%8d", i))
+	}
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < count*2; i += 2 {
+			_, _ = tx.Set(key(i), key(i))
+		}
+		return nil
+	})
+
+	// expect [min, max]中偶数的个数
+	expect := func(min, max int) int {
+		if min < 0 {
+			min = 0
+		}
+		if max < 0 || max >= count*2 {
+			max = count*2 - 1
+		}
+		if min > max {
+			return 0
+		}
+		return max/2 - (min+1)/2 + 1
+	}
+	bound := func(i int) []byte {
+		if i < 0 || i >= count*2 {
+			return Infinity
+		}
+		return key(i)
+	}
+
+	tests := [][2]int{{-1, -1}, {-1, 1000}, {1000, -1}, {0, 0}, {1, 1}, {3, 2}, {count, count + 5}, {count*2 - 2, -1}}
+	for i := 0; i < 100; i++ {
+		min := rand.Intn(count * 2)
+		tests = append(tests, [2]int{min, min + rand.Intn(count)})
+	}
+	for _, test := range tests {
+		num, err := db.Count(bound(test[0]), bound(test[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := expect(test[0], test[1]); num != want {
+			t.Fatal(test, num, want)
+		}
+
+		// 顺序写入的树很均匀，误差不超过总数的5%
+		approximate, err := db.ApproximateCount(bound(test[0]), bound(test[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := approximate - num; diff > count/20 || diff < -count/20 {
+			t.Fatal(test, approximate, num)
+		}
+	}
+
+	result, err := db.tree.fm.statisticsPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := db.ApproximateSize(Infinity, Infinity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafSize := int64(result.leafPageNum) * int64(result.pageSize)
+	if diff := size - leafSize; diff > leafSize/20 || diff < -leafSize/20 {
+		t.Fatal(size, leafSize)
+	}
+	half, _ := db.ApproximateSize(Infinity, key(count))
+	if half < size*2/5 || half > size*3/5 {
+		t.Fatal(half, size)
+	}
+	t.Log(result.leafPageNum, size, half)
+}
@@ -0,0 +1,225 @@
+package mydb
+
+import "bytes"
+
+// Cursor 游标，沿着叶子页的pre/next链表按key的顺序遍历，只在创建它的事务中有效
+// 在读写事务中修改数据后，需要重新定位游标
+// 遍历过程中出错时返回nil，可以通过Err获取错误
+type Cursor struct {
+	tx     *Tx // tree内部使用时为nil，由调用方保证并发安全
+	tree   *tree
+	page   *page
+	record *record
+	prefix []byte // SeekPrefix设置的前缀，不为nil时只遍历以prefix开头的记录
+	err    error
+}
+
+// Cursor 创建游标
+func (tx *Tx) Cursor() *Cursor {
+	return &Cursor{tx: tx, tree: tx.db.tree}
+}
+
+// Err 返回遍历过程中遇到的错误
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+func (c *Cursor) valid() bool {
+	if c.err == nil && c.tx != nil && c.tx.closed {
+		c.err = ErrTxClosed
+	}
+	return c.err == nil
+}
+
+func (c *Cursor) fail(err error) ([]byte, []byte) {
+	c.err = err
+	c.record = nil
+	return nil, nil
+}
+
+// First 定位到第一条记录，没有记录返回nil
+func (c *Cursor) First() (key, value []byte) {
+	if !c.valid() {
+		return nil, nil
+	}
+	c.prefix = nil
+
+	page, err := c.tree.fm.frontPage()
+	if err != nil {
+		return c.fail(err)
+	}
+	c.page = page
+	c.record = page.first()
+	return c.skipNext()
+}
+
+// Last 定位到最后一条记录，没有记录返回nil
+func (c *Cursor) Last() (key, value []byte) {
+	if !c.valid() {
+		return nil, nil
+	}
+	c.prefix = nil
+
+	fm := c.tree.fm
+	page, err := fm.rootPage()
+	if err != nil {
+		return c.fail(err)
+	}
+	for page.pageType() != pageTypeLeaf {
+		last := page.last()
+		if last == nil {
+			return c.fail(fm.corrupted(page.offset))
+		}
+		page, err = fm.page(last.child())
+		if err != nil {
+			return c.fail(err)
+		}
+	}
+	c.page = page
+	c.record = page.last()
+	return c.skipPre()
+}
+
+// Seek 定位到第一条大于等于key的记录，没有返回nil
+func (c *Cursor) Seek(key []byte) ([]byte, []byte) {
+	c.prefix = nil
+	return c.seek(key)
+}
+
+// SeekPrefix 定位到第一条以prefix开头的记录，之后Next和Prev遇到不以prefix开头的记录时返回nil
+// 以prefix开头的记录在比较器的顺序中必须是连续的，默认的按字节比较满足这个要求
+func (c *Cursor) SeekPrefix(prefix []byte) ([]byte, []byte) {
+	if len(prefix) == 0 {
+		return c.First()
+	}
+	c.prefix = prefix
+	return c.seek(prefix)
+}
+
+func (c *Cursor) seek(key []byte) ([]byte, []byte) {
+	if !c.valid() {
+		return nil, nil
+	}
+
+	page, err := c.tree._getLeafPage(key)
+	if err != nil {
+		return c.fail(err)
+	}
+	if page == nil {
+		// key小于所有记录，从第一条记录开始
+		page, err = c.tree.fm.frontPage()
+		if err != nil {
+			return c.fail(err)
+		}
+		c.page = page
+		c.record = page.first()
+		return c.skipNext()
+	}
+
+	c.page = page
+	_, c.record = page.find(key)
+	if c.record == nil {
+		c.record = page.first()
+		return c.skipNext()
+	}
+	if page.compare(c.record.Key, key) == 0 {
+		return c.current()
+	}
+	return c.Next()
+}
+
+// Next 移动到下一条记录，没有返回nil
+func (c *Cursor) Next() (key, value []byte) {
+	if !c.valid() || c.record == nil {
+		return nil, nil
+	}
+
+	if c.record.next != 0 {
+		c.record = c.page._record(c.record.next)
+		return c.current()
+	}
+	c.record = nil
+	return c.skipNext()
+}
+
+// Prev 移动到上一条记录，没有返回nil
+func (c *Cursor) Prev() (key, value []byte) {
+	if !c.valid() || c.record == nil {
+		return nil, nil
+	}
+
+	if c.record.pre != 0 {
+		c.record = c.page._record(c.record.pre)
+		return c.current()
+	}
+	c.record = nil
+	return c.skipPre()
+}
+
+// Key 当前记录的key，游标无效时返回nil
+func (c *Cursor) Key() []byte {
+	if !c.valid() || c.record == nil {
+		return nil
+	}
+	return c.record.Key
+}
+
+// Value 当前记录的value，游标无效时返回nil
+func (c *Cursor) Value() []byte {
+	if !c.valid() || c.record == nil {
+		return nil
+	}
+	value, err := c.tree.value(c.record)
+	if err != nil {
+		c.fail(err)
+		return nil
+	}
+	return value
+}
+
+// current 返回当前记录，读取溢出页出错或者超出前缀范围时返回nil
+func (c *Cursor) current() ([]byte, []byte) {
+	if c.prefix != nil && !bytes.HasPrefix(c.record.Key, c.prefix) {
+		c.record = nil
+		return nil, nil
+	}
+	value := c.Value()
+	if c.err != nil {
+		return nil, nil
+	}
+	return c.Key(), value
+}
+
+// skipNext 当前页没有记录时，移动到后面第一个有记录的页
+func (c *Cursor) skipNext() ([]byte, []byte) {
+	fm := c.tree.fm
+	for c.record == nil {
+		if c.page.next() == 0 {
+			return nil, nil
+		}
+		page, err := fm.page(c.page.next())
+		if err != nil {
+			return c.fail(err)
+		}
+		c.page = page
+		c.record = page.first()
+	}
+	return c.current()
+}
+
+// skipPre 当前页没有记录时，移动到前面第一个有记录的页
+func (c *Cursor) skipPre() ([]byte, []byte) {
+	fm := c.tree.fm
+	for c.record == nil {
+		if c.page.pre() == 0 {
+			return nil, nil
+		}
+		page, err := fm.page(c.page.pre())
+		if err != nil {
+			return c.fail(err)
+		}
+		c.page = page
+		c.record = page.last()
+	}
+	return c.current()
+}
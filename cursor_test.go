@@ -0,0 +1,146 @@
+package mydb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newDefaultDBWithData(n int) *DB {
+	db := newDefaultDB()
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < n; i++ {
+			data := []byte(fmt.Sprintf("%6d", i))
+			_, _ = tx.Set(data, data)
+		}
+		return nil
+	})
+	return db
+}
+
+func TestCursor_Next(t *testing.T) {
+	db := newDefaultDBWithData(5000)
+	defer db.Close()
+
+	_ = db.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		i := 0
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			data := fmt.Sprintf("%6d", i)
+			if string(k) != data || string(v) != data {
+				t.Fatal(i, string(k), string(v))
+			}
+			i++
+		}
+		if i != 5000 {
+			t.Fatal(i)
+		}
+		return nil
+	})
+}
+
+func TestCursor_Prev(t *testing.T) {
+	db := newDefaultDBWithData(5000)
+	defer db.Close()
+
+	_ = db.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		i := 4999
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			if string(k) != fmt.Sprintf("%6d", i) {
+				t.Fatal(i, string(k))
+			}
+			i--
+		}
+		if i != -1 {
+			t.Fatal(i)
+		}
+		return nil
+	})
+}
+
+func TestCursor_Seek(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 5000; i++ {
+			data := []byte(fmt.Sprintf("%6d", i*2))
+			_, _ = tx.Set(data, data)
+		}
+		return nil
+	})
+
+	_ = db.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		tests := []struct {
+			seek string
+			want string
+		}{
+			{seek: "", want: fmt.Sprintf("%6d", 0)},
+			{seek: fmt.Sprintf("%6d", 2000), want: fmt.Sprintf("%6d", 2000)},
+			{seek: fmt.Sprintf("%6d", 2001), want: fmt.Sprintf("%6d", 2002)},
+			{seek: fmt.Sprintf("%6d", 9998), want: fmt.Sprintf("%6d", 9998)},
+		}
+		for _, tt := range tests {
+			if k, _ := c.Seek([]byte(tt.seek)); string(k) != tt.want {
+				t.Fatalf("seek:%s got:%s want:%s", tt.seek, string(k), tt.want)
+			}
+		}
+
+		if k, _ := c.Seek([]byte(fmt.Sprintf("%6d", 9999))); k != nil {
+			t.Fatal(string(k))
+		}
+
+		k, _ := c.Seek([]byte(fmt.Sprintf("%6d", 3001)))
+		k, _ = c.Prev()
+		if string(k) != fmt.Sprintf("%6d", 3000) {
+			t.Fatal(string(k))
+		}
+		return nil
+	})
+}
+
+func TestCursor_SeekPrefix(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 5000; i++ {
+			data := []byte(fmt.Sprintf("%04d", i))
+			_, _ = tx.Set(data, data)
+		}
+		return nil
+	})
+
+	_ = db.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		var keys []string
+		for k, _ := c.SeekPrefix([]byte("123")); k != nil; k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		if len(keys) != 10 || keys[0] != "1230" || keys[9] != "1239" {
+			t.Fatal(keys)
+		}
+
+		// 反向遍历同样受前缀限制
+		k, _ := c.SeekPrefix([]byte("2000"))
+		if string(k) != "2000" {
+			t.Fatal(string(k))
+		}
+		if k, _ = c.Prev(); k != nil {
+			t.Fatal(string(k))
+		}
+
+		if k, _ = c.SeekPrefix([]byte("6")); k != nil {
+			t.Fatal(string(k))
+		}
+
+		// Seek之后不再受前缀限制
+		c.SeekPrefix([]byte("2000"))
+		c.Seek([]byte("2000"))
+		if k, _ = c.Next(); string(k) != "2001" {
+			t.Fatal(string(k))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,215 @@
+package mydb
+
+import "bytes"
+
+// DeleteRange 删除[min, max]之间的所有记录，返回删除的记录数，min或max为Infinity表示这一边没有边界
+// 沿着叶子页链表只遍历一次，整页都在范围内的叶子页直接回收，不逐条删除
+func (m *DB) DeleteRange(min, max []byte) (num int, err error) {
+	err = m.Update(func(tx *Tx) error {
+		num, err = tx.DeleteRange(min, max)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+func (tx *Tx) DeleteRange(min, max []byte) (int, error) {
+	err := tx.check(true)
+	if err != nil {
+		return 0, err
+	}
+	return tx.db.tree.deleteRange(min, max)
+}
+
+// deleteRange 从min所在的叶子页开始遍历，两端的叶子页逐条删除，中间的叶子页整页回收，
+// 最后沿着两端的路径自底向上处理下溢的页
+func (b *tree) deleteRange(min, max []byte) (int, error) {
+	var page *page
+	var err error
+	if !bytes.Equal(min, Infinity) {
+		page, err = b._getLeafPage(min)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if page == nil {
+		page, err = b.fm.frontPage()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	num := 0
+	for {
+		records := page.all()
+		start := 0
+		for start < len(records) && !b._isAfterMin(records[start].Key, min, false) {
+			start++
+		}
+		end := start
+		for end < len(records) && b._isBeforeMax(records[end].Key, max, false) {
+			end++
+		}
+		for _, r := range records[start:end] {
+			if r.isOverflow {
+				err = b.freeOverflow(r.Value)
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+
+		next := page.next()
+		// 树中至少保留一个叶子页
+		if start == 0 && end == len(records) && (page.pre() != 0 || next != 0) {
+			err = b._removeLeaf(page)
+			if err != nil {
+				return 0, err
+			}
+		} else {
+			for _, r := range records[start:end] {
+				page.delete(r.Key)
+			}
+		}
+		num += end - start
+
+		if end < len(records) || next == 0 {
+			break
+		}
+		page, err = b.fm.page(next)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if num == 0 {
+		return 0, nil
+	}
+
+	// 只有两端路径上的页被修改过，max为Infinity时右边已经没有页了
+	err = b._rebalancePath(min)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(max, Infinity) {
+		err = b._rebalancePath(max)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return num, nil
+}
+
+// _removeLeaf 把叶子页从链表和父页中摘除，然后回收
+func (b *tree) _removeLeaf(leaf *page) error {
+	if leaf.pre() == 0 {
+		b.fm.setFront(leaf.next())
+	} else {
+		pre, err := b.fm.page(leaf.pre())
+		if err != nil {
+			return err
+		}
+		pre.setNext(leaf.next())
+	}
+	if leaf.next() != 0 {
+		next, err := b.fm.page(leaf.next())
+		if err != nil {
+			return err
+		}
+		next.setPre(leaf.pre())
+	}
+
+	err := b._removeChild(leaf)
+	if err != nil {
+		return err
+	}
+	b.fm.recycle(leaf)
+	return nil
+}
+
+// _removeChild 从父页中删除child，父页因此变空时，父页也从它的父页中删除并回收
+// 删除的是第一个子页时，第一条记录改为指向第二个子页，这样父页的最小key不变，祖先页中的分隔key都不需要修改
+func (b *tree) _removeChild(child *page) error {
+	parent, err := b.fm.page(child.parent())
+	if err != nil {
+		return err
+	}
+	records, index, err := b._childIndex(parent, child.offset)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 1 {
+		// 树中还有其他叶子页，根页不会变空
+		if parent.parent() == 0 {
+			return b.fm.corrupted(parent.offset)
+		}
+		err = b._removeChild(parent)
+		if err != nil {
+			return err
+		}
+		b.fm.recycle(parent)
+		return nil
+	}
+
+	if index == 0 {
+		// value长度相同，原地更新一定有足够的空间
+		parent.setRecord(&record{Key: records[0].Key, Value: records[1].Value})
+		index = 1
+	}
+	parent.delete(records[index].Key)
+	return nil
+}
+
+// _rebalancePath 沿着key所在的路径自底向上处理下溢的页，合并之后路径会变化，每一层都重新查找
+func (b *tree) _rebalancePath(key []byte) error {
+	for level := 0; ; level++ {
+		path, err := b._path(key)
+		if err != nil {
+			return err
+		}
+		if level >= len(path) {
+			return nil
+		}
+
+		page := path[len(path)-1-level]
+		if page.parent() == 0 {
+			return b._collapseRoot(page)
+		}
+		if page.isUnderflow() {
+			err = b._rebalance(page)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// _path 从根页到key所在叶子页的路径，key小于所有分隔key或者是Infinity时走第一个子页
+func (b *tree) _path(key []byte) ([]*page, error) {
+	var path []*page
+	page, err := b.fm.rootPage()
+	if err != nil {
+		return nil, err
+	}
+	path = append(path, page)
+	for page.pageType() != pageTypeLeaf {
+		var child *record
+		if !bytes.Equal(key, Infinity) {
+			_, child = page.find(key)
+		}
+		if child == nil {
+			child = page.first()
+		}
+		if child == nil {
+			return nil, b.fm.corrupted(page.offset)
+		}
+		page, err = b.fm.page(child.child())
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, page)
+	}
+	return path, nil
+}
@@ -0,0 +1,115 @@
+package mydb
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDeleteRange(t *testing.T) {
+	seed := time.Now().Unix()
+	t.Log("seed", seed)
+	rand.Seed(seed)
+
+	db := newDefaultDB()
+	defer db.Close()
+
+	const count = 20000
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("%8d", i))
+	}
+	expect := make(map[int]bool)
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < count; i++ {
+			value := key(i)
+			if i%500 == 1 {
+				value = largeValue(i, 10000)
+			}
+			_, _ = tx.Set(key(i), value)
+			expect[i] = true
+		}
+		return nil
+	})
+
+	for n := 0; n < 20; n++ {
+		min := rand.Intn(count)
+		max := min + rand.Intn(count/10)
+		num, err := db.DeleteRange(key(min), key(max))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		for i := min; i <= max; i++ {
+			if expect[i] {
+				want++
+				delete(expect, i)
+			}
+		}
+		if num != want {
+			t.Fatal(min, max, num, want)
+		}
+		checkTree(t, db.tree)
+	}
+
+	kvs, err := db.Range(Infinity, Infinity)
+	if err != nil || len(kvs) != len(expect) {
+		t.Fatal(len(kvs), len(expect), err)
+	}
+	for _, kv := range kvs {
+		var i int
+		_, _ = fmt.Sscanf(string(kv.Key), "%d", &i)
+		if !expect[i] {
+			t.Fatal(string(kv.Key))
+		}
+	}
+
+	// 删除所有记录，溢出页和空的叶子页都被回收
+	num, err := db.DeleteRange(Infinity, Infinity)
+	if err != nil || num != len(expect) {
+		t.Fatal(num, len(expect), err)
+	}
+	checkTree(t, db.tree)
+	result, err := db.tree.fm.statisticsPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.leafPageNum != 1 || result.branchPageNum != 0 || result.overflowPageNum != 0 {
+		t.Fatal(result)
+	}
+
+	// 删除之后可以正常写入
+	_, _ = db.Set(key(1), key(1))
+	if value, err := db.Get(key(1)); err != nil || !bytes.Equal(value, key(1)) {
+		t.Fatal(string(value), err)
+	}
+}
+
+func TestDeleteRange_bound(t *testing.T) {
+	db := newDefaultDBWithData(10000)
+	defer db.Close()
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("%6d", i))
+	}
+	tests := []struct {
+		min, max []byte
+		num      int
+	}{
+		{key(100), key(99), 0},
+		{key(100), key(100), 1},
+		{key(100), key(100), 0},
+		{Infinity, key(999), 999},
+		{key(9000), Infinity, 1000},
+		{[]byte("a"), Infinity, 0},
+		{Infinity, Infinity, 8000},
+	}
+	for _, test := range tests {
+		num, err := db.DeleteRange(test.min, test.max)
+		if err != nil || num != test.num {
+			t.Fatal(string(test.min), string(test.max), num, err)
+		}
+		checkTree(t, db.tree)
+	}
+}
@@ -1,243 +1,89 @@
 package mydb
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand"
 	"testing"
 )
 
-func Test_dir_needSpaceLen(t *testing.T) {
-	d := dir{
-		offset:       defaultPageSize,
-		recordOffset: 1,
-		recordNum:    uint16(1),
-		key:          toBytes(111),
-	}
-	if d.needSpaceLen() != 9 {
-		t.Fatal()
-	}
-}
-
-func newDirPage(d ...*dir) *page {
+func Test_page__dirSearch(t *testing.T) {
 	page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
-	offset := uint16(defaultPageSize)
-	for _, v := range d {
-		v.offset = offset
-		page._dirSet(v)
-
-		offset -= v.needSpaceLen()
-		page._setIndexByFlag2(flag2DirBegin, offset)
+	if index, found := page._dirSearch(toBytes(1)); index != 0 || found {
+		t.Fatal(index, found)
 	}
-	return page
-}
-
-func TestNewDirPage(t *testing.T) {
-	page := newDirPage(
-		&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)},
-		&dir{recordOffset: 2, recordNum: 2, key: toBytes(2)},
-		&dir{recordOffset: 3, recordNum: 3, key: toBytes(3)},
-	)
-	fmt.Println(page._dirAll())
-}
 
-func Test_page__dirAdd(t *testing.T) {
-	// 空目录
-	page := newPage(make([]byte, defaultPageSize), 0, pageTypeBranch)
-	page._dirAdd(nil, &record{offset: uint16(1), Key: toBytes(1)})
-	if page._dirFind(toBytes(1)).recordNum != 1 {
-		t.Fatal()
+	for i := 0; i < 100; i += 2 {
+		key := []byte(fmt.Sprintf("%3d", i))
+		page.set(key, key)
 	}
-
-	// 目录累加
-	page = newDirPage(&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)})
-	page._dirAdd(page._dirFind(toBytes(1)), nil)
-	if page._dirFind(toBytes(1)).recordNum != 2 {
-		t.Fatal()
+	for i := 0; i < 100; i++ {
+		index, found := page._dirSearch([]byte(fmt.Sprintf("%3d", i)))
+		if index != (i+1)/2 || found != (i%2 == 0) {
+			t.Fatal(i, index, found)
+		}
 	}
-
-	// 越界测试
-	page = newDirPage(
-		&dir{recordOffset: 1, recordNum: 7, key: toBytes(1)},
-		&dir{recordOffset: 3, recordNum: 1, key: toBytes(3)},
-	)
-	page._setIndexByFlag2(flag2FreeBegin, 4096-14)
-	page._dirAdd(page._dirFind(toBytes(2)), &record{offset: 2, Key: toBytes(21)})
-	d := page._dirFind(toBytes(1))
-	if !d.equal(&dir{offset: page.size, recordOffset: 1, recordNum: 8, key: toBytes(1)}) {
-		t.Fatal(d)
+	if index, found := page._dirSearch([]byte("999")); index != 50 || found {
+		t.Fatal(index, found)
 	}
+}
 
-	// 目录分裂
-	recordByIndexIsMock = true
-	page = newDirPage(
-		&dir{recordOffset: 1, recordNum: 7, key: toBytes(1)},
-		&dir{recordOffset: 3, recordNum: 1, key: toBytes(3)},
-	)
-	page._dirAdd(page._dirFind(toBytes(2)), &record{offset: 2, Key: toBytes(21)})
-	d = page._dirFind(toBytes(1))
-	if !d.equal(&dir{offset: 4096, recordOffset: 1, recordNum: 4, key: toBytes(1)}) {
-		t.Fatal(d)
+func Test_page__dirInsert(t *testing.T) {
+	page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
+	page._dirInsert(0, 2)
+	page._dirInsert(0, 1)
+	page._dirInsert(2, 4)
+	page._dirInsert(2, 3)
+
+	slots := page._dirAll()
+	if fmt.Sprint(slots) != "[1 2 3 4]" {
+		t.Fatal(slots)
 	}
-	d = page._dirFind(toBytes(2))
-	if !d.equal(&dir{offset: 4087, recordOffset: 2, recordNum: 5, key: toBytes(2)}) {
-		t.Fatal(d)
+	if page._indexByFlag(flagDirBegin) != defaultPageSize-4*byte2 {
+		t.Fatal(page._indexByFlag(flagDirBegin))
 	}
 }
 
 func Test_page__dirDelete(t *testing.T) {
-	page := newDirPage(
-		&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)},
-		&dir{recordOffset: 2, recordNum: 2, key: toBytes(2)},
-		&dir{recordOffset: 3, recordNum: 1, key: toBytes(3)},
-	)
-
-	// 最后一个元素
-	page._dirDelete(*page._dirFind(toBytes(3)), record{})
-	if l := len(page._dirAll()); l != 2 {
-		t.Fatal(l)
+	page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
+	for i := 4; i >= 1; i-- {
+		page._dirInsert(0, uint32(i))
 	}
 
-	page = newDirPage(
-		&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)},
-		&dir{recordOffset: 2, recordNum: 2, key: toBytes(2)},
-		&dir{recordOffset: 3, recordNum: 3, key: toBytes(3)},
-	)
-	page._dirDelete(*page._dirFind(toBytes(3)), record{})
-	d := page._dirFind(toBytes(3))
-	if !d.equal(&dir{offset: 4082, recordOffset: 3, recordNum: 2, key: toBytes(3)}) {
-		t.Fatal(d)
+	page._dirDelete(2)
+	if slots := page._dirAll(); fmt.Sprint(slots) != "[1 2 4]" {
+		t.Fatal(slots)
 	}
-
-	page = newDirPage(
-		&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)},
-		&dir{recordOffset: 2, recordNum: 8, key: toBytes(2)},
-		&dir{recordOffset: 3, recordNum: 3, key: toBytes(3)},
-	)
-	page._dirDelete(*page._dirFind(toBytes(2)), record{})
-	d = page._dirFind(toBytes(2))
-	if !d.equal(&dir{offset: 4089, recordOffset: 2, recordNum: 7, key: toBytes(2)}) {
-		t.Fatal(d)
+	page._dirDelete(0)
+	if slots := page._dirAll(); fmt.Sprint(slots) != "[2 4]" {
+		t.Fatal(slots)
 	}
-
-	page = newDirPage(
-		&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)},
-		&dir{recordOffset: 2, recordNum: 2, key: toBytes(2)},
-		&dir{recordOffset: 3, recordNum: 3, key: toBytes(3)},
-	)
-	page._dirDelete(*page._dirFind(toBytes(2)), record{})
-	d = page._dirFind(toBytes(2))
-	if !d.equal(&dir{offset: 4089, recordOffset: 2, recordNum: 4, key: toBytes(2)}) {
-		t.Fatal(d)
-	}
-}
-
-func Test_page__dirPre(t *testing.T) {
-	page := newDirPage(
-		&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)},
-		&dir{recordOffset: 2, recordNum: 2, key: toBytes(2)},
-		&dir{recordOffset: 3, recordNum: 3, key: toBytes(3)},
-	)
-
-	d := page._dirFind(toBytes(1))
-	pre := page._dirPre(d.offset)
-	if pre != nil {
-		t.Fatal(pre)
-	}
-
-	d = page._dirFind(toBytes(2))
-	pre = page._dirPre(d.offset)
-	if !pre.equal(&dir{offset: page.size, recordOffset: 1, recordNum: 1, key: toBytes(1)}) {
-		t.Fatal(pre)
+	page._dirDelete(1)
+	page._dirDelete(0)
+	if page._dirNum() != 0 {
+		t.Fatal(page._dirAll())
 	}
 }
 
 func Test_page__dirRebuild(t *testing.T) {
-	var initPage = func(num int) *page {
-		page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
-		for i := 0; i < num; i++ {
-			buf := []byte(fmt.Sprintf("%03d", i))
-			page.set(buf, buf)
+	for _, pageSize := range []int{defaultPageSize, 1 << 16} {
+		p := newPage(make([]byte, pageSize), 0, pageTypeLeaf)
+		for _, i := range rand.Perm(200) {
+			key := []byte(fmt.Sprintf("%3d", i))
+			p.set(key, key)
 		}
-		return page
-	}
-
-	tests := []struct {
-		name      string
-		rnum      int
-		freeBegin uint16
-		dnum      int
-	}{
-		{
-			rnum:      1,
-			freeBegin: 0,
-		},
-		{
-			rnum:      10,
-			freeBegin: 0,
-		},
-		{
-			rnum:      20,
-			freeBegin: 0,
-		},
-		{
-			rnum:      20,
-			freeBegin: 4073,
-			dnum:      2,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			p := initPage(tt.rnum)
-			p._setIndexByFlag2(flag2FreeBegin, tt.freeBegin)
-			p._dirRebuild()
-
-			dirs := p._dirAll()
-
-			totalLen := uint16(0)
-			for i := range dirs {
-				totalLen += dirs[i].needSpaceLen()
-			}
-			dirBegin := p._indexByFlag2(flag2DirBegin)
+		slots := p._dirAll()
 
-			t.Log(dirs, dirBegin, totalLen, p.size-dirBegin)
+		p._dirRebuild()
+		if fmt.Sprint(p._dirAll()) != fmt.Sprint(slots) {
+			t.Fatal(p._dirAll())
+		}
 
-			dnum := tt.rnum/dirRecordMaxNum + 1
-			if tt.dnum != 0 {
-				dnum = tt.dnum
-			}
-			if len(dirs) != dnum {
-				t.Fatal()
+		all := p.all()
+		for i := range all {
+			if all[i].offset != slots[i] || !bytes.Equal(p._key(slots[i]), all[i].Key) {
+				t.Fatal(i)
 			}
-		})
-	}
-}
-
-func Test_page__dirDelRecordNum(t *testing.T) {
-	var initPage = func() *page {
-		return newDirPage(
-			&dir{recordOffset: 1, recordNum: 1, key: toBytes(1)},
-			&dir{recordOffset: 3, recordNum: 3, key: toBytes(3)},
-			&dir{recordOffset: 5, recordNum: 5, key: toBytes(5)},
-		)
+		}
 	}
-
-	// 移除目录
-	page := initPage()
-	dir := page._dirFind(toBytes(1))
-	dirDelRecordNumIsMock = true
-	page._dirDelRecordNum(*dir, record{offset: 1, Key: toBytes(1)})
-	t.Log(page._dirAll())
-
-	// 减掉目录的记录数
-	page = initPage()
-	dir = page._dirFind(toBytes(4))
-	dirDelRecordNumIsMock = true
-	page._dirDelRecordNum(*dir, record{offset: 4, Key: toBytes(4)})
-	t.Log(page._dirAll())
-
-	// d.key == r.key
-	page = initPage()
-	dir = page._dirFind(toBytes(4))
-	dirDelRecordNumIsMock = true
-	page._dirDelRecordNum(*dir, record{offset: 3, Key: toBytes(3)})
-	t.Log(page._dirAll())
 }
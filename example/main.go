@@ -16,16 +16,21 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	defer db.Close()
 
-	fmt.Println("init: ", db.Range(mydb.Infinity, mydb.Infinity))
+	kvs, err := db.Range(mydb.Infinity, mydb.Infinity)
+	fmt.Println("init: ", kvs, err)
 
 	for i := 1; i <= 5; i++ {
 		_, _ = db.Set(toBytes(i), toBytes(i))
 	}
-	fmt.Println("set:  ", db.Range(mydb.Infinity, mydb.Infinity))
+	kvs, err = db.Range(mydb.Infinity, mydb.Infinity)
+	fmt.Println("set:  ", kvs, err)
 
 	_ = db.Delete(toBytes(1))
-	fmt.Println("delete", db.Range(mydb.Infinity, mydb.Infinity))
+	kvs, err = db.Range(mydb.Infinity, mydb.Infinity)
+	fmt.Println("delete", kvs, err)
 
-	fmt.Println("range ", db.Range(toBytes(3), toBytes(4)))
+	kvs, err = db.Range(toBytes(3), toBytes(4))
+	fmt.Println("range ", kvs, err)
 }
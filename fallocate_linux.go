@@ -0,0 +1,13 @@
+package mydb
+
+import "syscall"
+
+// fallocate 为文件预先分配磁盘空间，同时扩大文件
+func fallocate(fd int, offset, length int64) error {
+	err := syscall.Fallocate(fd, 0, offset, length)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		// 文件系统不支持时退化为ftruncate
+		return syscall.Ftruncate(fd, offset+length)
+	}
+	return err
+}
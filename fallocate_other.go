@@ -0,0 +1,10 @@
+//go:build !linux
+
+package mydb
+
+import "syscall"
+
+// fallocate 不支持fallocate的平台直接扩大文件
+func fallocate(fd int, offset, length int64) error {
+	return syscall.Ftruncate(fd, offset+length)
+}
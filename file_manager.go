@@ -1,11 +1,22 @@
 package mydb
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"sort"
+	"sync"
 	"syscall"
+	"unsafe"
+)
+
+const (
+	minMmapSize  = 1 << 20 // 最小映射大小
+	maxMmapStep  = 1 << 30 // 映射每次最多增长大小
+	maxMmapSize  = 1 << 40 // 最大映射大小
+	mmapProtFlag = syscall.PROT_READ | syscall.PROT_WRITE
 )
 
 type fileManager struct {
@@ -15,6 +26,28 @@ type fileManager struct {
 
 	file *os.File
 	fd   int
+	size int64 // 文件大小
+
+	data     []byte   // 整个文件的内存映射，page直接引用其中的切片
+	mappings [][]byte // 所有建立的内存映射，最后一个是data，扩容后旧映射可能还被page引用，确定没有引用时再释放
+
+	wal     *wal
+	tx      *fmTx               // 当前写事务，为nil时直接修改映射
+	pending map[uint64][]byte   // 已经提交但是wal还没有刷盘的页，wal刷盘之后才能写入映射，否则崩溃时数据文件中可能有wal中没有的修改
+	touched map[uint64]struct{} // 不在写事务中时访问过的页，检查点时统一更新校验和
+	track   bool                // 是否记录touched，只有不通过写事务修改文件时才需要，并发读时必须关闭
+	verify  bool                // 读取页时是否校验校验和
+
+	verified   map[uint64]struct{} // 映射中已经校验过的页，页被重写或者截掉之后删除
+	verifiedMu sync.RWMutex        // 读事务会并发校验页
+
+	comparator comparator // key的比较器
+}
+
+// fmTx 写事务，事务中访问的页都是映射的副本，提交时先写入wal，再应用到映射
+type fmTx struct {
+	size  int64             // 事务中的文件大小
+	pages map[uint64][]byte // 事务中访问过的页副本，0是元数据页
 }
 
 const (
@@ -23,117 +56,581 @@ const (
 	recycleBegin = 16
 )
 
-func newFileManager(name string, pageSize uint64) (*fileManager, error) {
+func newFileManager(name string, options *options) (*fileManager, error) {
 	file, err := os.OpenFile(name, syscall.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, err
 	}
+	pageSize := options.pageSize
 	fm := &fileManager{
 		pageSize:      pageSize,
 		pageSizeInt:   int(pageSize),
 		pageSizeInt64: int64(pageSize),
 		file:          file,
 		fd:            int(file.Fd()),
+		verify:        options.verifyChecksum,
+		comparator:    options.comparator,
+		touched:       make(map[uint64]struct{}),
+		track:         true,
+		pending:       make(map[uint64][]byte),
+		verified:      make(map[uint64]struct{}),
 	}
 
-	if fm.fileSize() == 0 {
-		err = syscall.Ftruncate(fm.fd, fm.pageSizeInt64)
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	fm.size = info.Size()
+
+	fm.wal, err = openWal(name + ".wal")
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	err = fm.init()
+	if err == nil {
+		// 初始化时可能不通过写事务修改文件，结束之后才能释放旧映射
+		err = fm.unmapStale()
+	}
+	if err != nil {
+		_ = fm.release()
+		return nil, err
+	}
+	return fm, nil
+}
+
+// init 重放wal，如果是新文件，初始化元数据页和根页，否则校验文件头
+func (f *fileManager) init() error {
+	if f.size > 0 {
+		err := f.remap(f.size)
 		if err != nil {
-			return nil, err
+			return err
 		}
+	}
 
-		page := fm.allocatePage(pageTypeLeaf)
-		fm.setRoot(page.offset)
-		fm.setFront(page.offset)
+	err := f.recover()
+	if err != nil {
+		return err
 	}
-	return fm, nil
+
+	if f.size == 0 {
+		err = f.truncate(f.pageSizeInt64)
+		if err != nil {
+			return err
+		}
+	}
+	if f.size < defaultPageSize {
+		return ErrInvalidFile
+	}
+	if binary.BigEndian.Uint64(f.meta()[rootBegin:]) != 0 {
+		return f.checkHeader()
+	}
+	// 只有刚创建的文件才初始化
+	if f.size != f.pageSizeInt64 || !f.header().isLegacy() {
+		return ErrInvalidFile
+	}
+
+	f.begin()
+	page, err := f.allocatePage(pageTypeLeaf)
+	if err != nil {
+		f.rollback()
+		return err
+	}
+	f.setRoot(page.offset)
+	f.setFront(page.offset)
+	f.setHeader(&header{version: formatVersion, pageSize: f.pageSize, comparator: f.comparator.name})
+	err = f.commit()
+	if err != nil {
+		return err
+	}
+	return f.checkpoint()
 }
 
-func (f *fileManager) fileSize() int64 {
-	info, err := f.file.Stat()
+// mmapSize 计算映射大小，小于1G时成倍增长，之后每次增长1G
+func mmapSize(size int64) int64 {
+	if size <= minMmapSize {
+		return minMmapSize
+	}
+	if size < maxMmapStep {
+		newSize := int64(minMmapSize)
+		for newSize < size {
+			newSize *= 2
+		}
+		return newSize
+	}
+	if remainder := size % maxMmapStep; remainder != 0 {
+		size += maxMmapStep - remainder
+	}
+	return size
+}
+
+// remap 保证映射能够覆盖size大小的文件
+// 旧的映射不会立即释放，已经获取的page仍然可以安全使用，由于是MAP_SHARED，新旧映射的数据是一致的
+// 写事务提交之后或者初始化结束时调用unmapStale释放旧映射
+func (f *fileManager) remap(size int64) error {
+	if size <= int64(len(f.data)) {
+		return nil
+	}
+
+	length := mmapSize(size)
+	if length > maxMmapSize {
+		return fmt.Errorf("mmap size %d too large", length)
+	}
+
+	buf, err := syscall.Mmap(f.fd, 0, int(length), mmapProtFlag, syscall.MAP_SHARED)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	return info.Size()
+	f.mappings = append(f.mappings, buf)
+	f.data = buf
+	return nil
 }
 
-func (f *fileManager) rootPage() *page {
-	buf, err := syscall.Mmap(f.fd, 0, f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+// unmapStale 释放除了data以外的旧映射，调用时不能有page还引用旧映射
+// 写事务中的页都是副本，所以提交之后可以释放，不通过写事务修改文件时只能等到结束之后
+func (f *fileManager) unmapStale() error {
+	if len(f.mappings) <= 1 {
+		return nil
+	}
+
+	var firstErr error
+	for _, buf := range f.mappings[:len(f.mappings)-1] {
+		if err := syscall.Munmap(buf); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	f.mappings = [][]byte{f.data}
+	return firstErr
+}
+
+// truncate 调整文件大小，并按需扩大映射
+// 扩大文件时会预先分配磁盘空间，磁盘已满时返回ErrDiskFull，而不是在写回映射时出错
+func (f *fileManager) truncate(size int64) error {
+	var err error
+	if size > f.size {
+		err = fallocate(f.fd, f.size, size-f.size)
+	} else {
+		err = syscall.Ftruncate(f.fd, size)
+	}
 	if err != nil {
-		panic(err)
+		return ioError(err)
+	}
+	if size < f.size {
+		f.verifiedMu.Lock()
+		for offset := range f.verified {
+			if int64(offset) >= size {
+				delete(f.verified, offset)
+			}
+		}
+		f.verifiedMu.Unlock()
+	}
+	f.size = size
+	return f.remap(size)
+}
+
+// ioError 转换系统调用的错误
+func ioError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %v", ErrDiskFull, err)
+	}
+	return err
+}
+
+// close 刷新并释放所有内存映射，关闭文件
+func (f *fileManager) close() error {
+	f.tx = nil
+
+	var err error
+	if f.size > 0 && len(f.data) > 0 {
+		err = f.checkpoint()
+	}
+	if releaseErr := f.release(); err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+// release 不刷盘，直接释放所有内存映射，关闭文件
+func (f *fileManager) release() error {
+	var firstErr error
+	for _, buf := range f.mappings {
+		if err := syscall.Munmap(buf); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	f.mappings = nil
+	f.data = nil
+
+	if err := f.file.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if f.wal != nil {
+		if err := f.wal.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// begin 开启写事务，之后的修改在commit之前都不会写入映射
+func (f *fileManager) begin() {
+	f.tx = &fmTx{
+		size:  f.size,
+		pages: make(map[uint64][]byte),
 	}
-	index := binary.BigEndian.Uint64(buf[rootBegin:])
-	return f.page(index)
 }
 
-func (f *fileManager) frontPage() *page {
-	buf, err := syscall.Mmap(f.fd, 0, f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+// rollback 丢弃写事务中的所有修改
+func (f *fileManager) rollback() {
+	f.tx = nil
+}
+
+// commit 提交写事务，修改过的页先写入wal，再应用到映射
+// wal不刷盘时，页先保存在pending中，等到wal刷盘之后再应用到映射，保证数据文件中的修改一定能从wal重放
+func (f *fileManager) commit() error {
+	err := f._commit()
+	// 事务中的页都是副本，提交之后没有page还引用旧映射
+	if unmapErr := f.unmapStale(); err == nil {
+		err = unmapErr
+	}
+	return err
+}
+
+func (f *fileManager) _commit() error {
+	tx := f.tx
+	f.tx = nil
+
+	pages := tx.dirtyPages(f)
+	if len(pages) == 0 && tx.size == f.size {
+		return nil
+	}
+
+	oldSize := f.size
+	if tx.size > f.size {
+		err := f.truncate(tx.size)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := f.wal.append(tx.size, pages)
 	if err != nil {
-		panic(err)
+		if f.size != oldSize {
+			_ = f.truncate(oldSize)
+		}
+		return ioError(err)
 	}
 
-	return f.page(binary.BigEndian.Uint64(buf[frontBegin:]))
+	// 截断文件之前wal必须已经刷盘，只有压缩会让文件变小
+	if f.wal.noSync && tx.size >= f.size {
+		for _, p := range pages {
+			f.pending[p.offset] = p.buf
+		}
+	} else {
+		err = f.applyPending()
+		if err != nil {
+			return err
+		}
+		err = f.apply(tx.size, pages)
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.wal.size >= walCheckpointSize {
+		return f.checkpoint()
+	}
+	return nil
 }
 
-func (f *fileManager) setRoot(root uint64) {
-	buf, err := syscall.Mmap(f.fd, 0, f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+// dirtyPages 事务中内容发生变化的页，按offset排序，同时更新页的校验和
+func (t *fmTx) dirtyPages(f *fileManager) []walPage {
+	offsets := make([]uint64, 0, len(t.pages))
+	for offset, buf := range t.pages {
+		if int64(offset) < f.size && bytes.Equal(buf, f.committedBuf(offset)) {
+			continue
+		}
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	pages := make([]walPage, 0, len(offsets))
+	for _, offset := range offsets {
+		buf := t.pages[offset]
+		setChecksum(buf, checksumAt(offset))
+		pages = append(pages, walPage{offset: offset, buf: buf})
+	}
+	return pages
+}
+
+// apply 将页镜像写入映射
+func (f *fileManager) apply(fileSize int64, pages []walPage) error {
+	if fileSize != f.size {
+		err := f.truncate(fileSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range pages {
+		end := int64(p.offset) + int64(len(p.buf))
+		if end > f.size {
+			continue
+		}
+		copy(f.data[p.offset:end], p.buf)
+		f.unverify(p.offset)
+	}
+	return nil
+}
+
+// applyPending wal刷盘之后，把pending中的页写入映射
+func (f *fileManager) applyPending() error {
+	err := f.wal.sync()
 	if err != nil {
-		panic(err)
+		return ioError(err)
+	}
+	for offset, buf := range f.pending {
+		copy(f.data[offset:offset+f.pageSize], buf)
+		f.unverify(offset)
 	}
+	f.pending = make(map[uint64][]byte)
+	return nil
+}
 
-	binary.BigEndian.PutUint64(buf[rootBegin:], root)
+// sync 数据文件刷盘，清空wal
+func (f *fileManager) sync() error {
+	return f.checkpoint()
 }
 
-func (f *fileManager) setFront(front uint64) {
-	buf, err := syscall.Mmap(f.fd, 0, f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+// checkpoint 映射刷盘之后清空wal，刷盘前更新不在写事务中修改过的页的校验和
+func (f *fileManager) checkpoint() error {
+	err := f.applyPending()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	for offset := range f.touched {
+		if int64(offset)+f.pageSizeInt64 <= f.size {
+			setChecksum(f.data[offset:offset+f.pageSize], checksumAt(offset))
+		}
+	}
+	f.touched = make(map[uint64]struct{})
 
-	binary.BigEndian.PutUint64(buf[frontBegin:], front)
+	err = msync(f.data[:f.size])
+	if err != nil {
+		return err
+	}
+	err = f.file.Sync()
+	if err != nil {
+		return err
+	}
+	return f.wal.reset()
 }
 
-// page 获取page
-func (f *fileManager) page(offset uint64) *page {
-	buf, err := syscall.Mmap(f.fd, int64(offset), f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+// recover 重放wal中已经提交的事务
+func (f *fileManager) recover() error {
+	if f.wal.size == 0 {
+		return nil
+	}
+
+	err := f.wal.replay(f.apply)
 	if err != nil {
-		log.Println(err, offset)
-		panic(err)
+		return err
 	}
-	return &page{offset: offset, buf: buf, size: uint16(len(buf))}
+	if f.size == 0 {
+		return f.wal.reset()
+	}
+	return f.checkpoint()
 }
 
-// allocatePage 分配页空间，首先会尝试从回收空间分配，再申请新的磁盘空间
-func (f *fileManager) allocatePage(pageType uint16) *page {
-	// 从回收空间获取
-	buf, err := syscall.Mmap(f.fd, 0, f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+// msync 将映射的脏页同步写回文件
+func msync(buf []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (f *fileManager) fileSize() int64 {
+	return f.size
+}
+
+// meta 元数据页
+func (f *fileManager) meta() []byte {
+	return f.pageBuf(0)
+}
+
+func (f *fileManager) rootPage() (*page, error) {
+	return f.page(binary.BigEndian.Uint64(f.meta()[rootBegin:]))
+}
+
+func (f *fileManager) frontPage() (*page, error) {
+	return f.page(binary.BigEndian.Uint64(f.meta()[frontBegin:]))
+}
+
+func (f *fileManager) setRoot(root uint64) {
+	binary.BigEndian.PutUint64(f.meta()[rootBegin:], root)
+}
+
+func (f *fileManager) setFront(front uint64) {
+	binary.BigEndian.PutUint64(f.meta()[frontBegin:], front)
+}
+
+// page 获取page，offset不合法时返回ErrCorrupted
+func (f *fileManager) page(offset uint64) (*page, error) {
+	if offset == 0 || offset%f.pageSize != 0 || int64(offset) >= f.txSize() {
+		return nil, f.corrupted(offset)
+	}
+
+	err := f.verifyPage(offset)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	buf := f.pageBuf(offset)
+	return f.loadPage(buf, offset), nil
+}
+
+// loadPage 包装已经存在的页，页中的key使用文件的比较器排序
+func (f *fileManager) loadPage(buf []byte, offset uint64) *page {
+	p := loadPage(buf, offset)
+	p.compare = f.comparator.compare
+	return p
+}
+
+func (f *fileManager) newPage(buf []byte, offset uint64, pageType uint16) *page {
+	p := f.loadPage(buf, offset)
+	p.setPageType(pageType)
+	return p
+}
+
+// checksumAt 校验和在页中的位置，元数据页的校验和在文件头之后
+func checksumAt(offset uint64) int {
+	if offset == 0 {
+		return metaChecksumBegin
 	}
-	recycleOffset := binary.BigEndian.Uint64(buf[recycleBegin:])
+	return flag4Checksum
+}
+
+// verifyPage 校验映射中的页，每个页只在第一次读取时校验，已经访问过的页不用再校验
+func (f *fileManager) verifyPage(offset uint64) error {
+	if !f.verify || int64(offset) >= f.size {
+		return nil
+	}
+	if _, ok := f.touched[offset]; ok {
+		return nil
+	}
+	if _, ok := f.pending[offset]; ok {
+		return nil
+	}
+	if f.tx != nil {
+		if _, ok := f.tx.pages[offset]; ok {
+			return nil
+		}
+	}
+
+	f.verifiedMu.RLock()
+	_, ok := f.verified[offset]
+	f.verifiedMu.RUnlock()
+	if ok {
+		return nil
+	}
+
+	if !verifyChecksum(f.data[offset:offset+f.pageSize], checksumAt(offset)) {
+		return fmt.Errorf("%w: page offset %d checksum mismatch", ErrCorrupted, offset)
+	}
+	f.verifiedMu.Lock()
+	f.verified[offset] = struct{}{}
+	f.verifiedMu.Unlock()
+	return nil
+}
+
+// unverify 映射中的页被重写，下次读取时重新校验
+func (f *fileManager) unverify(offset uint64) {
+	f.verifiedMu.Lock()
+	delete(f.verified, offset)
+	f.verifiedMu.Unlock()
+}
+
+// corrupted 返回页损坏的错误
+func (f *fileManager) corrupted(offset uint64) error {
+	return fmt.Errorf("%w: page offset %d", ErrCorrupted, offset)
+}
+
+// txSize 当前的文件大小，包括写事务中新申请的页
+func (f *fileManager) txSize() int64 {
+	if f.tx != nil {
+		return f.tx.size
+	}
+	return f.size
+}
+
+// committedBuf 已经提交的页内容，wal还没有刷盘的页在pending中
+func (f *fileManager) committedBuf(offset uint64) []byte {
+	if buf, ok := f.pending[offset]; ok {
+		return buf
+	}
+	return f.data[offset : offset+f.pageSize : offset+f.pageSize]
+}
+
+// pageBuf 获取页的内容，写事务中返回页的副本，同一页在事务中始终返回同一个副本
+func (f *fileManager) pageBuf(offset uint64) []byte {
+	if f.tx == nil {
+		if f.track {
+			f.touched[offset] = struct{}{}
+		}
+		return f.committedBuf(offset)
+	}
+
+	if buf, ok := f.tx.pages[offset]; ok {
+		return buf
+	}
+	buf := make([]byte, f.pageSize)
+	if int64(offset) < f.size {
+		copy(buf, f.committedBuf(offset))
+	}
+	f.tx.pages[offset] = buf
+	return buf
+}
+
+// allocatePage 分配页空间，首先会尝试从回收空间分配，再申请新的磁盘空间
+func (f *fileManager) allocatePage(pageType uint16) (*page, error) {
+	// 从回收空间获取
+	meta := f.meta()
+	recycleOffset := binary.BigEndian.Uint64(meta[recycleBegin:])
 	if recycleOffset != 0 {
-		buf, err := syscall.Mmap(f.fd, int64(recycleOffset), f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+		recycled, err := f.page(recycleOffset)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		if recycled.pageType() != pageTypeRecycle {
+			return nil, f.corrupted(recycleOffset)
+		}
+		binary.BigEndian.PutUint64(meta[recycleBegin:], recycled.next())
 
-		page := newPage(buf, recycleOffset, pageType)
-		binary.BigEndian.PutUint64(buf[recycleBegin:], page.next())
-		return page
+		page := f.newPage(recycled.buf, recycleOffset, pageType)
+		page.setParent(0)
+		page.setPre(0)
+		page.setNext(0)
+		return page, nil
 	}
 
-	// 申请磁盘空间
-	fileSize := f.fileSize()
-	err = syscall.Ftruncate(f.fd, fileSize+f.pageSizeInt64)
-	if err != nil {
-		panic(err)
+	// 事务中只扩大事务的文件大小，提交时再申请磁盘空间
+	if f.tx != nil {
+		offset := uint64(f.tx.size)
+		f.tx.size += f.pageSizeInt64
+		return f.newPage(f.pageBuf(offset), offset, pageType), nil
 	}
 
-	buf, err = syscall.Mmap(f.fd, fileSize, f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
+	// 申请磁盘空间
+	fileSize := f.size
+	err := f.truncate(fileSize + f.pageSizeInt64)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return newPage(buf, uint64(fileSize), pageType)
+	return f.newPage(f.pageBuf(uint64(fileSize)), uint64(fileSize), pageType), nil
 }
 
 // recycle 回收空间
@@ -141,47 +638,43 @@ func (f *fileManager) recycle(page *page) {
 	page._reset()
 	page.setPageType(pageTypeRecycle)
 
-	buf, err := syscall.Mmap(f.fd, 0, f.pageSizeInt, syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		panic(err)
-	}
-
-	page.setNext(binary.BigEndian.Uint64(buf[recycleBegin:]))
-	binary.BigEndian.PutUint64(buf[recycleBegin:], page.offset)
+	meta := f.meta()
+	page.setNext(binary.BigEndian.Uint64(meta[recycleBegin:]))
+	binary.BigEndian.PutUint64(meta[recycleBegin:], page.offset)
 }
 
 type statisticsResult struct {
-	fileSize       uint64
-	pageSize       uint64
-	totalPageNum   uint64
-	branchPageNum  int
-	leafPageNum    int
-	recyclePageNum int
-	depth          int
-	recordNum      int
+	fileSize        uint64
+	pageSize        uint64
+	totalPageNum    uint64
+	branchPageNum   int
+	leafPageNum     int
+	recyclePageNum  int
+	overflowPageNum int
+	depth           int
+	recordNum       int
 }
 
 func (s *statisticsResult) String() string {
-	return fmt.Sprintf("fileSize:%dB, totalPageNum:%d, branchPageNum:%d, leafPageNum:%d, recyclePageNum:%d, depth:%d, recordNum:%d",
-		s.fileSize, s.fileSize/s.pageSize, s.branchPageNum, s.leafPageNum, s.recyclePageNum, s.depth, s.recordNum)
+	return fmt.Sprintf("fileSize:%dB, totalPageNum:%d, branchPageNum:%d, leafPageNum:%d, recyclePageNum:%d, overflowPageNum:%d, depth:%d, recordNum:%d",
+		s.fileSize, s.fileSize/s.pageSize, s.branchPageNum, s.leafPageNum, s.recyclePageNum, s.overflowPageNum, s.depth, s.recordNum)
 }
 
 // statistics page统计
-func (f *fileManager) statisticsPage() *statisticsResult {
+func (f *fileManager) statisticsPage() (*statisticsResult, error) {
 	var result statisticsResult
 	result.pageSize = f.pageSize
 
-	info, err := f.file.Stat()
-	if err != nil {
-		panic(err)
-	}
-	result.fileSize = uint64(info.Size())
+	result.fileSize = uint64(f.size)
 	result.totalPageNum = result.fileSize / f.pageSize
 
 	// 统计枝干页和叶子页数量
 	offset := f.pageSize
 	for offset < result.fileSize {
-		page := f.page(offset)
+		page, err := f.page(offset)
+		if err != nil {
+			return nil, err
+		}
 		switch page.pageType() {
 		case pageTypeBranch:
 			result.branchPageNum++
@@ -190,13 +683,18 @@ func (f *fileManager) statisticsPage() *statisticsResult {
 			result.recordNum += page.count()
 		case pageTypeRecycle:
 			result.recyclePageNum++
+		case pageTypeOverflow:
+			result.overflowPageNum++
 		}
 		offset += f.pageSize
 	}
 
 	// 统计b+树的深度
 	result.depth = 1
-	page := f.frontPage()
+	page, err := f.frontPage()
+	if err != nil {
+		return nil, err
+	}
 	for {
 		parent := page.parent()
 		if parent == 0 {
@@ -204,8 +702,11 @@ func (f *fileManager) statisticsPage() *statisticsResult {
 		}
 
 		result.depth++
-		page = f.page(parent)
+		page, err = f.page(parent)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &result
+	return &result, nil
 }
@@ -1,6 +1,8 @@
 package mydb
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -9,7 +11,8 @@ import (
 func newDefaultFileManager() *fileManager {
 	name := "data.txt"
 	os.Remove(name)
-	fm, err := newFileManager(name, defaultPageSize)
+	os.Remove(name + ".wal")
+	fm, err := newFileManager(name, getOptions())
 	if err != nil {
 		panic(err)
 	}
@@ -19,25 +22,26 @@ func newDefaultFileManager() *fileManager {
 func Test_newFileManager(t *testing.T) {
 	fm := newDefaultFileManager()
 
-	rootPage := fm.rootPage()
+	rootPage, _ := fm.rootPage()
 	if rootPage.offset != fm.pageSize {
 		t.Fatalf("root:%d", rootPage.offset)
 	}
 	fmt.Println(rootPage.pageType())
 
-	frontPage := fm.frontPage()
+	frontPage, _ := fm.frontPage()
 	if frontPage.offset != fm.pageSize {
 		t.Fatalf("front:%d", frontPage.offset)
 	}
 	fmt.Println(frontPage.pageType())
 
+	_, _ = fm.allocatePage(pageTypeLeaf)
 	fm.setRoot(fm.pageSize * 2)
-	if fm.rootPage().offset != fm.pageSize*2 {
+	if rootPage, _ = fm.rootPage(); rootPage.offset != fm.pageSize*2 {
 		t.FailNow()
 	}
 
 	fm.setFront(fm.pageSize * 2)
-	if fm.frontPage().offset != fm.pageSize*2 {
+	if frontPage, _ = fm.frontPage(); frontPage.offset != fm.pageSize*2 {
 		t.FailNow()
 	}
 }
@@ -45,10 +49,10 @@ func Test_newFileManager(t *testing.T) {
 func Test_fileManager_allocatePage(t *testing.T) {
 	fm := newDefaultFileManager()
 
-	if fm.allocatePage(pageTypeLeaf).offset != 8192 {
+	if page, _ := fm.allocatePage(pageTypeLeaf); page.offset != 8192 {
 		t.Fatal()
 	}
-	if fm.allocatePage(pageTypeLeaf).offset != 12288 {
+	if page, _ := fm.allocatePage(pageTypeLeaf); page.offset != 12288 {
 		t.Fatal()
 	}
 }
@@ -56,7 +60,7 @@ func Test_fileManager_allocatePage(t *testing.T) {
 func Test_fileManager_recycle(t *testing.T) {
 	fm := newDefaultFileManager()
 
-	page := fm.allocatePage(pageTypeLeaf)
+	page, _ := fm.allocatePage(pageTypeLeaf)
 	if fm.fileSize() != int64(fm.pageSize*3) {
 		t.Fail()
 	}
@@ -71,3 +75,73 @@ func Test_fileManager_recycle(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_fileManager_page(t *testing.T) {
+	fm := newDefaultFileManager()
+
+	for _, offset := range []uint64{0, 100, fm.pageSize * 2} {
+		if _, err := fm.page(offset); !errors.Is(err, ErrCorrupted) {
+			t.Fatal(offset, err)
+		}
+	}
+	if _, err := fm.page(fm.pageSize); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_fileManager_verifyPage(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_, _ = db.Set(toBytes(1), toBytes(1))
+	fm := db.tree.fm
+	root := binary.BigEndian.Uint64(fm.meta()[rootBegin:])
+	if _, err := db.Get(toBytes(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fm.verified[root]; !ok {
+		t.Fatal("root not verified")
+	}
+
+	// 校验过的页不再计算校验和，修改页中没有使用的空间
+	unused := root + fm.pageSize/2
+	fm.data[unused] ^= 1
+	if _, err := db.Get(toBytes(1)); err != nil {
+		t.Fatal(err)
+	}
+	fm.data[unused] ^= 1
+
+	// 提交重写了页，下次读取时重新校验
+	_, _ = db.Set(toBytes(2), toBytes(2))
+	if _, ok := fm.verified[root]; ok {
+		t.Fatal("root still verified")
+	}
+	fm.data[unused] ^= 1
+	if _, err := db.Get(toBytes(1)); !errors.Is(err, ErrCorrupted) {
+		t.Fatal(err)
+	}
+	fm.data[unused] ^= 1
+}
+
+func Test_fileManager_unmapStale(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	// 文件超过最小映射大小之后，每次扩大映射都会建立新的映射
+	fm := db.tree.fm
+	for i := 0; fm.size <= 4*minMmapSize; i++ {
+		_ = db.Update(func(tx *Tx) error {
+			for j := 0; j < 1000; j++ {
+				key := []byte(fmt.Sprintf("%8d-%4d", i, j))
+				_, _ = tx.Set(key, key)
+			}
+			return nil
+		})
+	}
+	if len(fm.mappings) != 1 || len(fm.data) < int(fm.size) {
+		t.Fatal(len(fm.mappings), len(fm.data), fm.size)
+	}
+	if value, err := db.Get([]byte(fmt.Sprintf("%8d-%4d", 0, 1))); err != nil || len(value) == 0 {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,275 @@
+package mydb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidFile      = errors.New("error invalid db file")
+	ErrVersionMismatch  = errors.New("error unsupported format version")
+	ErrPageSizeMismatch = errors.New("error page size mismatch")
+)
+
+// formatVersion 当前文件格式版本
+const formatVersion = 4
+
+const fileMagic = "MYDBFILE"
+
+/**
+元数据页 物理存储结构
+root      根页位置
+front     第一个叶子页位置
+recycle   回收页链表的第一个页位置
+magic     魔数，标识这是一个mydb文件
+version   文件格式版本
+flags     创建时的标志
+pageSize  页大小
+checksum  元数据页的校验和
+comparatorLen  比较器名字的长度，默认比较器为0
+comparator     比较器的名字
+rebuild   版本2升级到版本3时，下一个要移到新树中的旧叶子页位置，升级完成后为0
+*/
+const (
+	magicBegin         = 24
+	versionBegin       = 32
+	flagsBegin         = 36
+	pageSizeBegin      = 40
+	headerEnd          = 48
+	metaChecksumBegin  = 48
+	comparatorLenBegin = 52
+	comparatorBegin    = 53
+	rebuildBegin       = comparatorBegin + maxComparatorNameLen
+)
+
+// header 文件头
+type header struct {
+	magic      []byte
+	version    uint32
+	flags      uint32
+	pageSize   uint64
+	comparator string
+}
+
+func (f *fileManager) header() *header {
+	meta := f.meta()
+	return &header{
+		magic:    append([]byte(nil), meta[magicBegin:versionBegin]...),
+		version:  binary.BigEndian.Uint32(meta[versionBegin:]),
+		flags:    binary.BigEndian.Uint32(meta[flagsBegin:]),
+		pageSize: binary.BigEndian.Uint64(meta[pageSizeBegin:]),
+
+		comparator: string(meta[comparatorBegin : comparatorBegin+int(meta[comparatorLenBegin])]),
+	}
+}
+
+func (f *fileManager) setHeader(h *header) {
+	meta := f.meta()
+	copy(meta[magicBegin:versionBegin], fileMagic)
+	binary.BigEndian.PutUint32(meta[versionBegin:], h.version)
+	binary.BigEndian.PutUint32(meta[flagsBegin:], h.flags)
+	binary.BigEndian.PutUint64(meta[pageSizeBegin:], h.pageSize)
+	meta[comparatorLenBegin] = byte(len(h.comparator))
+	copy(meta[comparatorBegin:comparatorBegin+maxComparatorNameLen], h.comparator)
+}
+
+// isLegacy 没有文件头的旧文件，魔数全部为0
+func (h *header) isLegacy() bool {
+	for _, b := range h.magic {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidMeta 元数据页中的页位置是否合法
+func (f *fileManager) isValidMeta() bool {
+	meta := f.meta()
+	for _, begin := range []int{rootBegin, frontBegin, recycleBegin} {
+		offset := binary.BigEndian.Uint64(meta[begin:])
+		if offset%f.pageSize != 0 || int64(offset) >= f.size {
+			return false
+		}
+	}
+	return true
+}
+
+// migrations 格式迁移，migrations[i]将版本i的文件升级到版本i+1
+// 迁移直接修改映射，全部完成后才更新版本号并刷盘，所以迁移必须是可以重复执行的
+var migrations = []func(f *fileManager) error{
+	migrateV0,
+	migrateV1,
+	migrateV2,
+	migrateV3,
+}
+
+// migrateV0 版本0是没有文件头的旧文件，只能假定页大小就是打开时设置的页大小
+func migrateV0(f *fileManager) error {
+	f.setHeader(&header{pageSize: f.pageSize})
+	return nil
+}
+
+// migrateV1 版本2增加了页校验和，访问所有的页，检查点时会计算校验和
+func migrateV1(f *fileManager) error {
+	for offset := uint64(0); int64(offset) < f.size; offset += f.pageSize {
+		f.pageBuf(offset)
+	}
+	return nil
+}
+
+// rebuildBatchSize 重建树时每个写事务处理的旧页的总大小，至少处理一个页
+var rebuildBatchSize int64 = 1 << 20
+
+// migrateV2 版本3的页目录改成了定长的slot数组，旧页目录的页放入slot数组后可能放不下，所以重建整棵树
+// 重建分成很多个写事务，每个事务只处理rebuildBatchSize大小的旧页，内存和wal的占用不随数据量增长：
+// 先回收所有旧的枝干页，再从旧的叶子页链表的头开始，把叶子页中的记录写入新树，然后回收这个叶子页
+// 下一个要移动的旧叶子页记录在元数据页中，中途崩溃后重新打开会从这里继续，溢出页不需要改动
+func migrateV2(f *fileManager) error {
+	r := &rebuilder{f: f, batch: int(rebuildBatchSize / f.pageSizeInt64), scan: f.pageSize}
+	if r.batch < 1 {
+		r.batch = 1
+	}
+	for {
+		f.begin()
+		done, err := r.step()
+		if err != nil {
+			f.rollback()
+			return err
+		}
+		if done {
+			h := f.header()
+			h.version = 3
+			f.setHeader(h)
+		}
+		err = f.commit()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// rebuilder 分批重建树，scan是回收旧枝干页时扫描到的位置，只在内存中，重新打开时从头扫描
+type rebuilder struct {
+	f     *fileManager
+	batch int
+	scan  uint64
+}
+
+// step 在一个写事务中处理一批旧页，done表示所有的旧叶子页都已经移到新树中
+func (r *rebuilder) step() (done bool, err error) {
+	f := r.f
+	meta := f.meta()
+	next := binary.BigEndian.Uint64(meta[rebuildBegin:])
+	if next == 0 {
+		// 升级开始之前文件中只有旧树，所有的枝干页都是旧的，新树只从旧的叶子页链表读取，不需要旧的枝干页
+		recycled, err := r.recycleBranch()
+		if err != nil || recycled > 0 {
+			return false, err
+		}
+
+		// 旧的叶子页链表交给rebuildBegin，front和root指向新树的根页
+		root, err := f.allocatePage(pageTypeLeaf)
+		if err != nil {
+			return false, err
+		}
+		binary.BigEndian.PutUint64(meta[rebuildBegin:], binary.BigEndian.Uint64(meta[frontBegin:]))
+		f.setRoot(root.offset)
+		f.setFront(root.offset)
+		return false, nil
+	}
+
+	tree := newTree(f)
+	for i := 0; i < r.batch && next != 0; i++ {
+		page, err := f.page(next)
+		if err != nil {
+			return false, err
+		}
+		if page.pageType() != pageTypeLeaf {
+			return false, f.corrupted(next)
+		}
+		for _, old := range page.all() {
+			_, err = tree._put(&record{Key: old.Key, Value: old.Value, isOverflow: old.isOverflow})
+			if err != nil {
+				return false, err
+			}
+		}
+		next = page.next()
+		f.recycle(page)
+	}
+	binary.BigEndian.PutUint64(meta[rebuildBegin:], next)
+	return next == 0, nil
+}
+
+// recycleBranch 回收最多batch个旧的枝干页，返回回收的页数
+func (r *rebuilder) recycleBranch() (int, error) {
+	f := r.f
+	recycled := 0
+	for ; recycled < r.batch && int64(r.scan) < f.size; r.scan += f.pageSize {
+		page, err := f.page(r.scan)
+		if err != nil {
+			return 0, err
+		}
+		if page.pageType() == pageTypeBranch {
+			f.recycle(page)
+			recycled++
+		}
+	}
+	return recycled, nil
+}
+
+// migrateV3 版本4在文件头中增加了比较器的名字，之前的文件都使用默认比较器，名字为空，不需要修改
+func migrateV3(f *fileManager) error {
+	return nil
+}
+
+// checkHeader 校验文件头，必要时做格式迁移
+func (f *fileManager) checkHeader() error {
+	h := f.header()
+
+	version := h.version
+	if h.isLegacy() {
+		version = 0
+		if !f.isValidMeta() {
+			return ErrInvalidFile
+		}
+	} else {
+		if string(h.magic) != fileMagic {
+			return ErrInvalidFile
+		}
+		if version > formatVersion {
+			return fmt.Errorf("%w: file version %d, supported version %d", ErrVersionMismatch, version, formatVersion)
+		}
+		if h.pageSize != f.pageSize {
+			return fmt.Errorf("%w: file page size %d, option page size %d", ErrPageSizeMismatch, h.pageSize, f.pageSize)
+		}
+	}
+	// 迁移可能会按key重建树，所以要在迁移之前检查比较器
+	if version < 4 {
+		h.comparator = ""
+	}
+	if h.comparator != f.comparator.name {
+		return fmt.Errorf("%w: file comparator %q, option comparator %q", ErrComparatorMismatch, h.comparator, f.comparator.name)
+	}
+	if f.size%f.pageSizeInt64 != 0 {
+		return fmt.Errorf("%w: file size %d is not a multiple of page size %d", ErrInvalidFile, f.size, f.pageSize)
+	}
+	if version == formatVersion {
+		if !verifyChecksum(f.meta(), metaChecksumBegin) {
+			return f.corrupted(0)
+		}
+		return nil
+	}
+
+	for ; version < formatVersion; version++ {
+		err := migrations[version](f)
+		if err != nil {
+			return err
+		}
+	}
+	h = f.header()
+	h.version = formatVersion
+	f.setHeader(h)
+	return f.checkpoint()
+}
@@ -0,0 +1,205 @@
+package mydb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_fileManager_checkHeader(t *testing.T) {
+	fm := newDefaultFileManager()
+	h := fm.header()
+	if string(h.magic) != fileMagic || h.version != formatVersion || h.pageSize != defaultPageSize {
+		t.Fatal(h)
+	}
+	_ = fm.close()
+
+	_, err := newFileManager("data.txt", getOptions(WithPageSize(defaultPageSize*2)))
+	if !errors.Is(err, ErrPageSizeMismatch) {
+		t.Fatal(err)
+	}
+
+	// 更高版本的文件
+	fm, _ = newFileManager("data.txt", getOptions())
+	h.version = formatVersion + 1
+	fm.setHeader(h)
+	_ = fm.close()
+	_, err = newFileManager("data.txt", getOptions())
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Fatal(err)
+	}
+}
+
+func Test_fileManager_checkHeader_invalid(t *testing.T) {
+	name := "data.txt"
+	os.Remove(name + ".wal")
+	buf := make([]byte, defaultPageSize*2)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	_ = os.WriteFile(name, buf, 0666)
+
+	_, err := newFileManager(name, getOptions())
+	if !errors.Is(err, ErrInvalidFile) {
+		t.Fatal(err)
+	}
+
+	_ = os.WriteFile(name, buf[:100], 0666)
+	_, err = newFileManager(name, getOptions())
+	if !errors.Is(err, ErrInvalidFile) {
+		t.Fatal(err)
+	}
+}
+
+func Test_fileManager_migrate(t *testing.T) {
+	fm := newDefaultFileManager()
+	tree := newTree(fm)
+	for i := 0; i < 1000; i++ {
+		_, _ = tree.set(toBytes(i), toBytes(i))
+	}
+
+	// 模拟没有文件头的旧文件
+	copy(fm.meta()[magicBegin:headerEnd], make([]byte, headerEnd-magicBegin))
+	_ = fm.close()
+
+	fm, err := newFileManager("data.txt", getOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.close()
+
+	h := fm.header()
+	if string(h.magic) != fileMagic || h.version != formatVersion || h.pageSize != defaultPageSize {
+		t.Fatal(h)
+	}
+	if num, _ := newTree(fm).count(); num != 1000 {
+		t.Fatal(num)
+	}
+}
+
+// newV2FileManager 模拟版本2的文件，版本2的页目录不能按slot读取，这里直接清空
+func newV2FileManager(n int) *fileManager {
+	fm := newDefaultFileManager()
+	tree := newTree(fm)
+	for i := 0; i < n; i++ {
+		_, _ = tree.set(toBytes(i), toBytes(i))
+	}
+	_, _ = tree.set(toBytes(n), largeValue(n, 10000))
+
+	for offset := fm.pageSize; int64(offset) < fm.size; offset += fm.pageSize {
+		page, _ := fm.page(offset)
+		if page.pageType() == pageTypeLeaf || page.pageType() == pageTypeBranch {
+			page._setIndexByFlag(flagDirBegin, 0)
+		}
+	}
+	h := fm.header()
+	h.version = 2
+	fm.setHeader(h)
+	return fm
+}
+
+// checkMigrateV2 打开升级后的文件，检查所有记录都在，并且旧的页都已经回收
+func checkMigrateV2(t *testing.T, n int) {
+	fm, err := newFileManager("data.txt", getOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.close()
+
+	if h := fm.header(); h.version != formatVersion {
+		t.Fatal(h)
+	}
+	if next := binary.BigEndian.Uint64(fm.meta()[rebuildBegin:]); next != 0 {
+		t.Fatal(next)
+	}
+	tree := newTree(fm)
+	for i := 0; i < n; i++ {
+		value, ok, err := tree.get(toBytes(i))
+		if err != nil || !ok || !bytes.Equal(value, toBytes(i)) {
+			t.Fatal(i, value, err)
+		}
+	}
+	value, _, err := tree.get(toBytes(n))
+	if err != nil || !bytes.Equal(value, largeValue(n, 10000)) {
+		t.Fatal(len(value), err)
+	}
+	checkTree(t, tree)
+
+	stats, err := tree.stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageNum := 0
+	for _, num := range stats.LevelPageNum {
+		pageNum += num
+	}
+	if pageNum != stats.BranchPageNum+stats.LeafPageNum || stats.FreeListLen != stats.RecyclePageNum || stats.RecordNum != n+1 {
+		t.Fatalf("%+v", stats)
+	}
+}
+
+func Test_fileManager_migrateV2(t *testing.T) {
+	fm := newV2FileManager(1000)
+	_ = fm.close()
+	checkMigrateV2(t, 1000)
+}
+
+func Test_fileManager_migrateV2_resume(t *testing.T) {
+	defer func(n int64) { rebuildBatchSize = n }(rebuildBatchSize)
+	rebuildBatchSize = defaultPageSize
+
+	// 每个事务只处理一个页，处理到一半时关闭，模拟崩溃
+	fm := newV2FileManager(20000)
+	r := &rebuilder{f: fm, batch: 1, scan: fm.pageSize}
+	for i := 0; i < 100; i++ {
+		fm.begin()
+		done, err := r.step()
+		if err != nil || done {
+			t.Fatal(done, err)
+		}
+		if err = fm.commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next := binary.BigEndian.Uint64(fm.meta()[rebuildBegin:]); next == 0 {
+		t.Fatal(next)
+	}
+	_ = fm.close()
+
+	checkMigrateV2(t, 20000)
+}
+
+func TestChecksum(t *testing.T) {
+	db := newDefaultDB()
+	for i := 0; i < 1000; i++ {
+		_, _ = db.Set(toBytes(i), toBytes(i))
+	}
+	_ = db.Close()
+
+	// 修改一个叶子页的内容
+	file, _ := os.OpenFile("data", os.O_RDWR, 0666)
+	_, _ = file.WriteAt([]byte("x"), defaultPageSize+recordsDefaultBegin+10)
+	_ = file.Close()
+
+	db, err := Open("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Range(Infinity, Infinity)
+	if !errors.Is(err, ErrCorrupted) || !strings.Contains(err.Error(), "4096") {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	db, err = Open("data", WithVerifyChecksum(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err = db.Range(Infinity, Infinity); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,76 +2,164 @@ package mydb
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"sync"
+	"time"
 )
 
 var (
 	ErrRecordTooLarge = errors.New("error key value too large")
 	ErrRecordNotExist = errors.New("error record not exist")
+	ErrClosed         = errors.New("error db closed")
+	ErrDiskFull       = errors.New("error disk full")
+	ErrCorrupted      = errors.New("error db corrupted")
 )
 
-type myDB struct {
-	tree *tree
-	m    sync.RWMutex
+// KV 键值对
+type KV struct {
+	Key   []byte
+	Value []byte
 }
 
-func Open(fileName string, opts ...Option) (*myDB, error) {
+func (kv KV) String() string {
+	return fmt.Sprintf("{Key:%s,Value:%s}", string(kv.Key), string(kv.Value))
+}
+
+// Store 键值存储接口，DB实现了这个接口，方便调用方mock或者包装
+type Store interface {
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) (isNew bool, err error)
+	Delete(key []byte) error
+	Range(min, max []byte) ([]KV, error)
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
+
+// DB 数据库
+type DB struct {
+	tree   *tree
+	m      sync.RWMutex
+	closed bool
+	stop   chan struct{} // 关闭定时刷盘
+}
+
+// Open 打开数据库，文件不存在时创建
+func Open(fileName string, opts ...Option) (*DB, error) {
 	options := getOptions(opts...)
 
-	fm, err := newFileManager(fileName, options.pageSize)
+	fm, err := newFileManager(fileName, options)
 	if err != nil {
 		return nil, err
 	}
-
-	return &myDB{tree: newTree(fm)}, nil
+	fm.wal.noSync = options.syncMode.kind != syncAlways
+	// 之后所有的修改都在写事务中，读事务可以并发访问
+	fm.track = false
+
+	db := &DB{tree: newTree(fm)}
+	if options.syncMode.kind == syncInterval {
+		db.stop = make(chan struct{})
+		go db.syncLoop(options.syncMode.interval)
+	}
+	return db, nil
 }
 
-func (m *myDB) checkParam(key, value []byte) error {
-	r := record{Key: key, Value: value}
-	if r.needSpaceLen() > recordMaxSize(uint16(m.tree.fm.pageSize)) {
-		return ErrRecordTooLarge
+// syncLoop 定时刷盘
+func (m *DB) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := m.Sync()
+			if err != nil && err != ErrClosed {
+				log.Println("sync error", err)
+			}
+		case <-m.stop:
+			return
+		}
 	}
-	return nil
 }
 
-func (m *myDB) Set(key, value []byte) (isNew bool, err error) {
-	err = m.checkParam(key, value)
-	if err != nil {
-		return
-	}
+// checkParam 检查key和value的大小，value太大时会存储到溢出页，记录中只保存key和溢出页指针
+func (m *DB) checkParam(key, value []byte) error {
+	return m.tree.checkParam(key, value)
+}
 
-	m.m.Lock()
-	defer m.m.Unlock()
+func (m *DB) Set(key, value []byte) (isNew bool, err error) {
+	err = m.Update(func(tx *Tx) error {
+		isNew, err = tx.Set(key, value)
+		return err
+	})
+	return
+}
 
-	isNew = m.tree.set(key, value)
+func (m *DB) Delete(key []byte) error {
+	return m.Update(func(tx *Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+func (m *DB) Get(key []byte) (value []byte, err error) {
+	err = m.View(func(tx *Tx) error {
+		value, err = tx.Get(key)
+		return err
+	})
 	return
 }
 
-func (m *myDB) Delete(key []byte) error {
-	m.m.Lock()
-	defer m.m.Unlock()
+func (m *DB) Range(min, max []byte) (kvs []KV, err error) {
+	err = m.View(func(tx *Tx) error {
+		kvs, err = tx.Range(min, max)
+		return err
+	})
+	return
+}
+
+// Prefix 按key的顺序遍历所有以prefix开头的记录，fn返回false时停止遍历，fn中不能调用DB的写方法
+func (m *DB) Prefix(prefix []byte, fn func(key, value []byte) bool) error {
+	return m.View(func(tx *Tx) error {
+		return tx.Prefix(prefix, fn)
+	})
+}
+
+func toKVs(records []*record) []KV {
+	if len(records) == 0 {
+		return nil
+	}
 
-	ok := m.tree.delete(key)
-	if !ok {
-		return ErrRecordNotExist
+	kvs := make([]KV, len(records))
+	for i, r := range records {
+		kvs[i] = KV{Key: r.Key, Value: r.Value}
 	}
-	return nil
+	return kvs
 }
 
-func (m *myDB) Get(key []byte) ([]byte, error) {
-	m.m.RLock()
-	defer m.m.RUnlock()
+// Sync 将所有已经提交的修改刷盘
+func (m *DB) Sync() error {
+	m.m.Lock()
+	defer m.m.Unlock()
 
-	value, ok := m.tree.get(key)
-	if !ok {
-		return nil, ErrRecordNotExist
+	if m.closed {
+		return ErrClosed
 	}
-	return value, nil
+	return m.tree.fm.sync()
 }
 
-func (m *myDB) Range(min, max []byte) []*record {
-	m.m.RLock()
-	defer m.m.RUnlock()
+// Close 关闭数据库，刷新并释放所有内存映射，关闭文件，关闭后的所有调用都返回ErrClosed
+func (m *DB) Close() error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	m.closed = true
+	if m.stop != nil {
+		close(m.stop)
+	}
 
-	return m.tree.query(min, max)
+	return m.tree.fm.close()
 }
@@ -1,9 +1,14 @@
 package mydb
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -12,18 +17,312 @@ func init() {
 
 func TestOpen(t *testing.T) {
 	os.Remove("data")
+	os.Remove("data.wal")
 	db, err := Open("data")
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	defer db.Close()
+
 	for i := 1; i <= 5; i++ {
 		_, _ = db.Set(toBytes(i), toBytes(i))
 	}
-	log.Println("set:  ", db.Range(Infinity, Infinity))
+	log.Println(db.Range(Infinity, Infinity))
 
 	_ = db.Delete(toBytes(1))
-	log.Println("delete", db.Range(Infinity, Infinity))
+	log.Println(db.Range(Infinity, Infinity))
+
+	log.Println(db.Range(toBytes(3), toBytes(4)))
+}
+
+func TestClose(t *testing.T) {
+	os.Remove("data")
+	os.Remove("data.wal")
+	db, err := Open("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = db.Set(toBytes(1), toBytes(1))
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Set(toBytes(2), toBytes(2)); err != ErrClosed {
+		t.Fatal(err)
+	}
+	if _, err = db.Get(toBytes(1)); err != ErrClosed {
+		t.Fatal(err)
+	}
+	if _, err = db.Range(Infinity, Infinity); err != ErrClosed {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != ErrClosed {
+		t.Fatal(err)
+	}
+
+	db, err = Open("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	value, err := db.Get(toBytes(1))
+	if err != nil || string(value) != "1" {
+		t.Fatal(string(value), err)
+	}
+}
 
-	log.Println("range ", db.Range(toBytes(3), toBytes(4)))
+func TestSync(t *testing.T) {
+	os.Remove("data")
+	os.Remove("data.wal")
+	db, err := Open("data", WithSyncMode(SyncNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = db.Set(toBytes(1), toBytes(1))
+	if db.tree.fm.wal.size == 0 {
+		t.Fatal()
+	}
+	if err = db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if db.tree.fm.wal.size != 0 {
+		t.Fatal(db.tree.fm.wal.size)
+	}
+	_ = db.Close()
+
+	db, err = Open("data", WithSyncMode(SyncInterval(10*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, _ = db.Set(toBytes(2), toBytes(2))
+	time.Sleep(100 * time.Millisecond)
+
+	db.m.RLock()
+	size := db.tree.fm.wal.size
+	db.m.RUnlock()
+	if size != 0 {
+		t.Fatal(size)
+	}
+}
+
+func TestSync_crash(t *testing.T) {
+	os.Remove("data")
+	os.Remove("data.wal")
+	db, err := Open("data", WithSyncMode(SyncNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 1000; i++ {
+			_, _ = tx.Set(toBytes(i), toBytes(i))
+		}
+		return nil
+	})
+	if err = db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	synced, err := os.ReadFile("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有刷盘的提交，会产生页分裂
+	for i := 1000; i < 3000; i += 20 {
+		_ = db.Update(func(tx *Tx) error {
+			for j := i; j < i+20; j++ {
+				_, _ = tx.Set(toBytes(j), toBytes(j))
+			}
+			return nil
+		})
+	}
+
+	// 数据文件中的页随时可能被内核写回磁盘，wal刷盘之前不能有任何修改，只能扩大文件
+	current, err := os.ReadFile("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current[:len(synced)], synced) || len(bytes.Trim(current[len(synced):], "\x00")) != 0 {
+		t.Fatal("data file changed before wal synced")
+	}
+
+	// 模拟数据文件的页已经写回磁盘，wal没有写回时崩溃
+	os.Remove("data.txt")
+	os.Remove("data.txt.wal")
+	if err = os.WriteFile("data.txt", current, 0666); err != nil {
+		t.Fatal(err)
+	}
+	crashed, err := Open("data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crashed.Close()
+	checkTree(t, crashed.tree)
+	if num, _ := crashed.Count(Infinity, Infinity); num != 1000 {
+		t.Fatal(num)
+	}
+
+	// 刷盘之后所有提交都写入了数据文件
+	if err = db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if num, _ := db.Count(Infinity, Infinity); num != 3000 {
+		t.Fatal(num)
+	}
+	checkTree(t, db.tree)
+}
+
+func TestRange(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	var store Store = db
+	for i := 1; i <= 5; i++ {
+		_, _ = store.Set(toBytes(i), toBytes(i))
+	}
+
+	kvs, err := store.Range(toBytes(2), toBytes(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 3 || string(kvs[0].Key) != "2" || string(kvs[2].Value) != "4" {
+		t.Fatal(kvs)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 100; i++ {
+			for j := 0; j < 100; j++ {
+				key := []byte(fmt.Sprintf("user:%d:%d", i, j))
+				_, _ = tx.Set(key, key)
+			}
+		}
+		return nil
+	})
+
+	tests := []struct {
+		prefix string
+		num    int
+	}{
+		{prefix: "user:42:", num: 100},
+		{prefix: "user:42", num: 100},
+		{prefix: "user:4", num: 1100},
+		{prefix: "user:42:5", num: 11},
+		{prefix: "user:100", num: 0},
+		{prefix: "a", num: 0},
+		{prefix: "", num: 10000},
+	}
+	for _, tt := range tests {
+		num := 0
+		err := db.Prefix([]byte(tt.prefix), func(key, value []byte) bool {
+			if !bytes.HasPrefix(key, []byte(tt.prefix)) || !bytes.Equal(key, value) {
+				t.Fatal(string(key), string(value))
+			}
+			num++
+			return true
+		})
+		if err != nil || num != tt.num {
+			t.Fatal(tt.prefix, num, err)
+		}
+	}
+
+	// fn返回false时停止
+	num := 0
+	_ = db.Prefix([]byte("user:1"), func(key, value []byte) bool {
+		num++
+		return num < 10
+	})
+	if num != 10 {
+		t.Fatal(num)
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_, _ = db.Set(toBytes(1), toBytes(1))
+
+	fm := db.tree.fm
+	meta := fm.meta()
+	root := binary.BigEndian.Uint64(meta[rootBegin:])
+	binary.BigEndian.PutUint64(meta[rootBegin:], fm.pageSize*100)
+
+	if _, err := db.Get(toBytes(1)); !errors.Is(err, ErrCorrupted) {
+		t.Fatal(err)
+	}
+	if _, err := db.Set(toBytes(2), toBytes(2)); !errors.Is(err, ErrCorrupted) {
+		t.Fatal(err)
+	}
+
+	binary.BigEndian.PutUint64(meta[rootBegin:], root)
+	if value, err := db.Get(toBytes(1)); err != nil || string(value) != "1" {
+		t.Fatal(string(value), err)
+	}
+}
+
+func TestOpen_largePageSize(t *testing.T) {
+	for _, pageSize := range []uint64{1 << 16, 1 << 17, 1 << 20} {
+		os.Remove("data")
+		os.Remove("data.wal")
+		db, err := Open("data", WithPageSize(pageSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := 5000
+		err = db.Update(func(tx *Tx) error {
+			for i := 0; i < n; i++ {
+				if _, err := tx.Set(toBytes(i), toBytes(i)); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Set(toBytes(n), make([]byte, pageSize))
+			return err
+		})
+		if err != nil {
+			t.Fatal(pageSize, err)
+		}
+		_ = db.Close()
+
+		db, err = Open("data", WithPageSize(pageSize))
+		if err != nil {
+			t.Fatal(pageSize, err)
+		}
+		kvs, err := db.Range(Infinity, Infinity)
+		if err != nil || len(kvs) != n+1 {
+			t.Fatal(pageSize, len(kvs), err)
+		}
+		for i := 0; i < n; i++ {
+			if value, err := db.Get(toBytes(i)); err != nil || string(value) != string(toBytes(i)) {
+				t.Fatal(pageSize, i, string(value), err)
+			}
+		}
+		_ = db.Close()
+	}
+}
+
+func TestWithPageSize(t *testing.T) {
+	for _, pageSize := range []uint64{defaultPageSize - 1, defaultPageSize + 1, maxPageSize * 2} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal(pageSize)
+				}
+			}()
+			WithPageSize(pageSize)
+		}()
+	}
+	WithPageSize(maxPageSize)
 }
@@ -1,10 +1,47 @@
 package mydb
 
+import "time"
+
 const defaultPageSize = 4096
 
+type syncKind int
+
+const (
+	syncAlways syncKind = iota
+	syncInterval
+	syncNone
+)
+
+// SyncMode 持久化模式
+type SyncMode struct {
+	kind     syncKind
+	interval time.Duration
+}
+
+var (
+	// SyncAlways 每次提交都刷盘，提交成功即持久化
+	SyncAlways = SyncMode{kind: syncAlways}
+	// SyncNone 提交不刷盘，只在wal检查点、调用Sync或者Close时刷盘
+	// 刷盘之前提交的页保存在内存中，不会写入数据文件，崩溃时丢失这些提交，但是文件不会损坏
+	SyncNone = SyncMode{kind: syncNone}
+)
+
+// SyncInterval 提交不刷盘，每隔d时间刷盘一次，崩溃最多丢失d时间内的提交
+// 和SyncNone一样，刷盘之前提交的页保存在内存中，wal超过检查点大小时也会提前刷盘
+func SyncInterval(d time.Duration) SyncMode {
+	if d <= 0 {
+		panic("sync interval must greater than zero")
+	}
+	return SyncMode{kind: syncInterval, interval: d}
+}
+
 // options 初始化参数
 type options struct {
-	pageSize uint64
+	pageSize       uint64
+	syncMode       SyncMode
+	verifyChecksum bool
+	fillFactor     float64
+	comparator     comparator
 }
 
 type Option interface {
@@ -25,20 +62,52 @@ func newFuncServerOption(f func(*options)) *funcOption {
 	}
 }
 
-// WithPageSize 设置页大小,默认值是4K
+// WithPageSize 设置页大小,默认值是4K,最大值是maxPageSize
 func WithPageSize(pageSize uint64) Option {
 	if pageSize < defaultPageSize || pageSize%defaultPageSize != 0 {
 		panic("pageSize must greater or equal to 4096 and remainder of 4096 is zero")
 	}
+	if pageSize > maxPageSize {
+		panic("pageSize must less or equal to 2G")
+	}
 
 	return newFuncServerOption(func(o *options) {
 		o.pageSize = pageSize
 	})
 }
 
+// WithSyncMode 设置持久化模式,默认值是SyncAlways
+func WithSyncMode(mode SyncMode) Option {
+	return newFuncServerOption(func(o *options) {
+		o.syncMode = mode
+	})
+}
+
+// WithVerifyChecksum 设置读取页时是否校验校验和,默认值是true,关闭可以提高读取速度
+func WithVerifyChecksum(verify bool) Option {
+	return newFuncServerOption(func(o *options) {
+		o.verifyChecksum = verify
+	})
+}
+
+// WithFillFactor 设置BulkLoad时每页的填充比例,默认值是0.9,留出的空间可以减少之后写入时的分裂
+func WithFillFactor(fillFactor float64) Option {
+	if fillFactor <= 0 || fillFactor > 1 {
+		panic("fillFactor must greater than 0 and less or equal to 1")
+	}
+
+	return newFuncServerOption(func(o *options) {
+		o.fillFactor = fillFactor
+	})
+}
+
 func getOptions(opts ...Option) *options {
 	options := &options{
-		pageSize: 4096,
+		pageSize:       4096,
+		syncMode:       SyncAlways,
+		verifyChecksum: true,
+		fillFactor:     0.9,
+		comparator:     defaultComparator,
 	}
 
 	for _, o := range opts {
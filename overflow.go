@@ -0,0 +1,145 @@
+package mydb
+
+import "encoding/binary"
+
+// maxValueLen value的最大长度
+const maxValueLen = 1 << 30
+
+// overflowPointerLen 溢出页指针的长度
+const overflowPointerLen = 16
+
+/**
+overflow pointer 物理存储结构，存储在叶子页记录的value中
+offset  溢出页链表的第一个页位置
+length  value的总长度
+
+溢出页从recordsDefaultBegin开始存储value的数据，通过页的next串联
+*/
+
+// overflowPageCap 每个溢出页可以存储的数据长度
+func (b *tree) overflowPageCap() int {
+	return int(b.fm.pageSize) - recordsDefaultBegin
+}
+
+// isOverflow value是否需要存储到溢出页
+func (b *tree) isOverflow(key, value []byte) bool {
+	r := record{Key: key, Value: value}
+	return len(value) > int(b.fm.pageSize) || r.needSpaceLen(offsetLen(b.fm.pageSize)) > recordMaxSize(b.fm.pageSize)
+}
+
+// checkParam 检查key和value的大小，value太大时会存储到溢出页，记录中只保存key和溢出页指针
+func (b *tree) checkParam(key, value []byte) error {
+	pageSize := b.fm.pageSize
+	if len(value) > maxValueLen || len(key) > int(pageSize) {
+		return ErrRecordTooLarge
+	}
+	r := record{Key: key, Value: make([]byte, overflowPointerLen)}
+	if r.needSpaceLen(offsetLen(pageSize)) > recordMaxSize(pageSize) {
+		return ErrRecordTooLarge
+	}
+	return nil
+}
+
+// writeOverflow 将value写入新申请的溢出页链表，返回溢出页指针
+func (b *tree) writeOverflow(value []byte) ([]byte, error) {
+	capacity := b.overflowPageCap()
+	var first, pre *page
+	for begin := 0; begin < len(value) || first == nil; begin += capacity {
+		end := begin + capacity
+		if end > len(value) {
+			end = len(value)
+		}
+
+		page, err := b.fm.allocatePage(pageTypeOverflow)
+		if err != nil {
+			return nil, err
+		}
+		copy(page.buf[recordsDefaultBegin:], value[begin:end])
+		if pre == nil {
+			first = page
+		} else {
+			pre.setNext(page.offset)
+			page.setPre(pre.offset)
+		}
+		pre = page
+	}
+
+	pointer := make([]byte, overflowPointerLen)
+	binary.BigEndian.PutUint64(pointer, first.offset)
+	binary.BigEndian.PutUint64(pointer[byte8:], uint64(len(value)))
+	return pointer, nil
+}
+
+// readOverflow 根据溢出页指针读取完整的value
+func (b *tree) readOverflow(pointer []byte) ([]byte, error) {
+	offset := binary.BigEndian.Uint64(pointer)
+	length := binary.BigEndian.Uint64(pointer[byte8:])
+	if length > maxValueLen {
+		return nil, b.fm.corrupted(offset)
+	}
+
+	value := make([]byte, 0, length)
+	for uint64(len(value)) < length {
+		page, err := b._overflowPage(offset)
+		if err != nil {
+			return nil, err
+		}
+		end := recordsDefaultBegin + int(length) - len(value)
+		if end > len(page.buf) {
+			end = len(page.buf)
+		}
+		value = append(value, page.buf[recordsDefaultBegin:end]...)
+		offset = page.next()
+	}
+	return value, nil
+}
+
+// freeOverflow 回收溢出页链表
+func (b *tree) freeOverflow(pointer []byte) error {
+	offset := binary.BigEndian.Uint64(pointer)
+	for offset != 0 {
+		page, err := b._overflowPage(offset)
+		if err != nil {
+			return err
+		}
+		// recycle会修改next，需要先读取
+		offset = page.next()
+		b.fm.recycle(page)
+	}
+	return nil
+}
+
+// value 获取记录的value，value存储在溢出页时读取溢出页
+func (b *tree) value(r *record) ([]byte, error) {
+	if !r.isOverflow {
+		return r.Value, nil
+	}
+	return b.readOverflow(r.Value)
+}
+
+// resolve 将records中存储在溢出页的value替换为完整的value
+func (b *tree) resolve(records []*record) error {
+	for _, r := range records {
+		if !r.isOverflow {
+			continue
+		}
+		value, err := b.readOverflow(r.Value)
+		if err != nil {
+			return err
+		}
+		r.Value = value
+		r.isOverflow = false
+	}
+	return nil
+}
+
+func (b *tree) _overflowPage(offset uint64) (*page, error) {
+	page, err := b.fm.page(offset)
+	if err != nil {
+		return nil, err
+	}
+	if page.pageType() != pageTypeOverflow {
+		return nil, b.fm.corrupted(offset)
+	}
+	return page, nil
+}
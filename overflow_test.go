@@ -0,0 +1,100 @@
+package mydb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func largeValue(i, n int) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("%6d", i)), n/6+1)[:n]
+}
+
+func TestOverflow(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	sizes := []int{3000, 4096, 100000, 3 << 20}
+	for i, size := range sizes {
+		if _, err := db.Set(toBytes(i), largeValue(i, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, size := range sizes {
+		value, err := db.Get(toBytes(i))
+		if err != nil || !bytes.Equal(value, largeValue(i, size)) {
+			t.Fatal(i, len(value), err)
+		}
+	}
+
+	kvs, err := db.Range(Infinity, Infinity)
+	if err != nil || len(kvs) != len(sizes) {
+		t.Fatal(len(kvs), err)
+	}
+	for i := range kvs {
+		if !bytes.Equal(kvs[i].Value, largeValue(i, sizes[i])) {
+			t.Fatal(i)
+		}
+	}
+
+	_ = db.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		i := len(sizes) - 1
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if !bytes.Equal(v, largeValue(i, sizes[i])) {
+				t.Fatal(i)
+			}
+			i--
+		}
+		if c.Err() != nil || i != -1 {
+			t.Fatal(i, c.Err())
+		}
+		return nil
+	})
+
+	// 覆盖为小value和删除都会回收溢出页
+	if _, err = db.Set(toBytes(3), toBytes(3)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = db.Delete(toBytes(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := db.tree.fm.statisticsPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.overflowPageNum != 0 || result.recyclePageNum == 0 {
+		t.Fatal(result)
+	}
+
+	// 回收的页会被再次使用
+	size := result.fileSize
+	if _, err = db.Set(toBytes(4), largeValue(4, 100000)); err != nil {
+		t.Fatal(err)
+	}
+	result, err = db.tree.fm.statisticsPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.fileSize != size || result.overflowPageNum == 0 {
+		t.Fatal(result)
+	}
+	value, err := db.Get(toBytes(3))
+	if err != nil || string(value) != "3" {
+		t.Fatal(string(value), err)
+	}
+}
+
+func TestOverflow_checkParam(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	if _, err := db.Set(bytes.Repeat([]byte{1}, 3000), toBytes(1)); err != ErrRecordTooLarge {
+		t.Fatal(err)
+	}
+	if _, err := db.Set(toBytes(1), make([]byte, maxValueLen+1)); err != ErrRecordTooLarge {
+		t.Fatal(err)
+	}
+}
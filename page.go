@@ -4,55 +4,88 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 )
 
 const recordsDefaultBegin = 64
 
 const (
-	pageTypeBranch  = 0 // 枝干
-	pageTypeLeaf    = 1 // 叶子
-	pageTypeRecycle = 2 // 被回收
+	pageTypeBranch   = 0 // 枝干
+	pageTypeLeaf     = 1 // 叶子
+	pageTypeRecycle  = 2 // 被回收
+	pageTypeOverflow = 3 // 溢出页，存储大value
 )
 
 const (
 	byte2 = 2
+	byte4 = 4
 	byte8 = 8
 )
 
+// maxPageSize 最大页大小，页内偏移量最多用4个字节表示，valueLen的最高位用作溢出标志
+const maxPageSize = 1 << 31
+
 const (
 	flag8Parent = 0  // 页父节点位置
 	flag8Pre    = 8  // 页前置节点位置
 	flag8Next   = 16 // 页后置节点位置
 
-	flag2Type         = 32 // 页类型
-	flag2RecordBegin  = 34 // 记录空间开始位置
-	flag2RecycleBegin = 36 // 回收空间开始位置
-	flag2FreeBegin    = 38 // 空闲空间开始位置
-	flag2DirBegin     = 40 // 目录空间开始位置
+	flag2Type = 32 // 页类型
+
+	flagRecordBegin  = 34 // 记录空间开始位置
+	flagRecycleBegin = 36 // 回收空间开始位置
+	flagFreeBegin    = 38 // 空闲空间开始位置
+	flagDirBegin     = 40 // 目录空间开始位置
+
+	flag4Checksum = 44 // 页校验和
+
+	wideFlagBegin = 48 // 大页的页内偏移量占4个字节，放在校验和之后
 )
 
+/**
+页内偏移量（记录和目录中的偏移量、长度，以及页头中的记录、回收、空闲、目录空间开始位置）的字节数由页大小决定
+页大小小于64K时用2个字节，否则用4个字节，见offsetLen
+*/
+
 type page struct {
-	offset      uint64
-	buf         []byte
-	size        uint16
-	minDirBegin uint16
+	offset uint64
+	buf    []byte
+	size   uint32
+	width  uint32 // 页内偏移量的字节数
+
+	compare func(a, b []byte) int // key的比较器
 }
 
-func newPage(buf []byte, offset uint64, pageType uint16) *page {
+// offsetLen 页内偏移量的字节数
+func offsetLen(pageSize uint64) uint32 {
+	if pageSize < 1<<16 {
+		return byte2
+	}
+	return byte4
+}
+
+// loadPage 包装已经存在的页
+func loadPage(buf []byte, offset uint64) *page {
 	p := &page{
 		offset: offset,
 		buf:    buf,
-		size:   uint16(len(buf)),
-	}
+		size:   uint32(len(buf)),
+		width:  offsetLen(uint64(len(buf))),
 
-	p.minDirBegin = (p.size - recordsDefaultBegin) / 2 / 8
-	p._setIndexByFlag2(flag2Type, pageType)
+		compare: bytes.Compare,
+	}
 	if p.size == 0 {
 		panic("size == 0")
 	}
 	return p
 }
 
+func newPage(buf []byte, offset uint64, pageType uint16) *page {
+	p := loadPage(buf, offset)
+	p.setPageType(pageType)
+	return p
+}
+
 func (p *page) display() {
 	all := p.all()
 	for i := range all {
@@ -62,11 +95,11 @@ func (p *page) display() {
 }
 
 func (p *page) pageType() uint16 {
-	return p._indexByFlag2(flag2Type)
+	return binary.BigEndian.Uint16(p.buf[flag2Type:])
 }
 
 func (p *page) setPageType(pageType uint16) {
-	p._setIndexByFlag2(flag2Type, pageType)
+	binary.BigEndian.PutUint16(p.buf[flag2Type:], pageType)
 }
 
 func (p *page) offsetBuf() []byte {
@@ -100,52 +133,63 @@ func (p *page) setNext(index uint64) {
 }
 
 func (p *page) get(key []byte) ([]byte, bool) {
-	_, r := p.find(key)
-	if r == nil || !bytes.Equal(r.Key, key) {
+	r := p.getRecord(key)
+	if r == nil {
 		return nil, false
 	}
 
 	return r.Value, true
 }
 
+// getRecord 获取key对应的记录，不存在返回nil
+func (p *page) getRecord(key []byte) *record {
+	index, found := p._dirSearch(key)
+	if !found {
+		return nil
+	}
+	return p._record(p._slot(index))
+}
+
 // set 设置
 // isNew 是否是新纪录
 // isEnoughSpace 是否空间足够
 func (p *page) set(key, value []byte) (isNew bool, isEnoughSpace bool) {
+	return p.setRecord(&record{Key: key, Value: value})
+}
+
+// setRecord 设置记录，会保留记录的isOverflow标志
+func (p *page) setRecord(r *record) (isNew bool, isEnoughSpace bool) {
+	key := r.Key
 	isEnoughSpace = true
-	dir, current := p.find(key)
+	index, found := p._dirSearch(key)
 
 	// record存在且原地址空间符合，直接更新
-	isNew = current == nil || !bytes.Equal(current.Key, key)
-	if !isNew {
+	// 比较器认为相等的key可能字节不同，总是保存最后写入的key
+	isNew = !found
+	if found {
+		current := p._record(p._slot(index))
 		new := *current
-		new.Value = value
-		if new.needSpaceLen() <= current.spaceLen {
+		new.Key = key
+		new.Value = r.Value
+		new.isOverflow = r.isOverflow
+		if new.needSpaceLen(p.width) <= current.spaceLen {
+			new.spaceLen = p._splitSpace(new.offset, current.spaceLen, new.needSpaceLen(p.width))
 			p._setRecord(&new)
-			isEnoughSpace = true
 			return
 		}
 
 		p._deleteRecord(*current)
-
-		p._dirDelete(*dir, *current)
-		// 这里可能删除目录，或者目录产生移位，还可能目录合并，需要重新获取
-		dir = p._dirFind(key)
+		p._dirDelete(index)
 	}
 
-	// 原地址空间不符合或者记录不存在，需要添加
-	// 找到添加pre位置
-	preOffset := uint16(0)
-	if current != nil {
-		if isNew {
-			preOffset = current.offset
-		} else {
-			preOffset = current.pre
-		}
+	// 原地址空间不符合或者记录不存在，需要添加到index位置
+	new := &record{Key: key, Value: r.Value, isOverflow: r.isOverflow}
+	offset, spaceLen, ok := p._getSpace(new.needSpaceLen(p.width))
+	if !ok && p._isFragmented(new.needSpaceLen(p.width)) {
+		// 碎片整理不会改变记录的顺序，index仍然有效
+		p._defragment()
+		offset, spaceLen, ok = p._getSpace(new.needSpaceLen(p.width))
 	}
-
-	new := &record{Key: key, Value: value}
-	offset, spaceLen, ok := p._getSpace(new.needSpaceLen())
 	if !ok {
 		// 这里存在更新的时候，空间不足的情况
 		isEnoughSpace = false
@@ -153,9 +197,9 @@ func (p *page) set(key, value []byte) (isNew bool, isEnoughSpace bool) {
 	}
 	new.offset = offset
 	new.spaceLen = spaceLen
-	if preOffset == 0 {
-		recordBegin := p._indexByFlag2(flag2RecordBegin)
-		p._setIndexByFlag2(flag2RecordBegin, new.offset)
+	if index == 0 {
+		recordBegin := p._indexByFlag(flagRecordBegin)
+		p._setIndexByFlag(flagRecordBegin, new.offset)
 
 		new.pre = 0
 		new.next = recordBegin
@@ -167,7 +211,7 @@ func (p *page) set(key, value []byte) (isNew bool, isEnoughSpace bool) {
 			p._setRecord(next)
 		}
 	} else {
-		pre := p._record(preOffset)
+		pre := p._record(p._slot(index - 1))
 		preNext := pre.next
 		pre.next = new.offset
 		p._setRecord(pre)
@@ -183,23 +227,23 @@ func (p *page) set(key, value []byte) (isNew bool, isEnoughSpace bool) {
 		}
 	}
 
-	p._dirAdd(dir, new)
+	p._dirInsert(index, new.offset)
 	return
 }
 
 func (p *page) delete(key []byte) bool {
-	d, r := p.find(key)
-	if r == nil || !bytes.Equal(r.Key, key) {
+	index, found := p._dirSearch(key)
+	if !found {
 		return false
 	}
 
-	p._deleteRecord(*r)
-	p._dirDelete(*d, *r)
+	p._deleteRecord(*p._record(p._slot(index)))
+	p._dirDelete(index)
 	return true
 }
 
 func (p *page) min() []byte {
-	beginIndex := p._indexByFlag2(flag2RecordBegin)
+	beginIndex := p._indexByFlag(flagRecordBegin)
 	if beginIndex == 0 {
 		return []byte("")
 	}
@@ -207,6 +251,24 @@ func (p *page) min() []byte {
 	return record.Key
 }
 
+// first 页中的第一条记录，页为空返回nil
+func (p *page) first() *record {
+	beginIndex := p._indexByFlag(flagRecordBegin)
+	if beginIndex == 0 {
+		return nil
+	}
+	return p._record(beginIndex)
+}
+
+// last 页中的最后一条记录，页为空返回nil
+func (p *page) last() *record {
+	num := p._dirNum()
+	if num == 0 {
+		return nil
+	}
+	return p._record(p._slot(num - 1))
+}
+
 func (p *page) updateMinKey(key []byte) bool {
 	min := p.min()
 	value, _ := p.get(min)
@@ -215,27 +277,89 @@ func (p *page) updateMinKey(key []byte) bool {
 	return isEnoughSpace
 }
 
+// capacity 页中可以用来存储记录的空间
+func (p *page) capacity() uint32 {
+	return p.size - recordsDefaultBegin
+}
+
+// isUnderflow 记录占用的空间少于四分之一，需要和兄弟页合并或者从兄弟页借用记录
+func (p *page) isUnderflow() bool {
+	return p._usedSpace()*4 < p.capacity()
+}
+
+// _usedSpace 记录和目录占用的空间，从页头和回收链表计算，不读取记录
+// 空闲空间之前除了回收链表中的空间都被记录占用，记录复用回收空间时可能多占用不到一条最短记录的空间
+func (p *page) _usedSpace() uint32 {
+	freeBegin := p._indexByFlag(flagFreeBegin)
+	if freeBegin == 0 {
+		freeBegin = recordsDefaultBegin
+	}
+	return freeBegin - recordsDefaultBegin - p._recycledBytes() + p.size - p._dirBegin()
+}
+
+// rebuild 清空页，重新按顺序写入records，空间不够时返回false
+func (p *page) rebuild(records []*record) bool {
+	p._reset()
+	for i := range records {
+		_, isEnoughSpace := p.setRecord(records[i])
+		if !isEnoughSpace {
+			return false
+		}
+	}
+	return true
+}
+
+// usedSpace records占用的空间，每条记录还占用目录中的一个slot
+func usedSpace(records []*record, width uint32) uint32 {
+	var used uint32
+	for i := range records {
+		used += records[i].needSpaceLen(width) + width
+	}
+	return used
+}
+
+// splitIndex 将records分成两部分，使占用空间较大的一部分尽可能小，records至少有两条记录
+func splitIndex(records []*record, width uint32) int {
+	total := usedSpace(records, width)
+
+	var used uint32
+	index := 1
+	for i := 0; i < len(records)-1; i++ {
+		used += records[i].needSpaceLen(width) + width
+		index = i + 1
+		if used*2 >= total {
+			// 比较在当前记录之前分割和之后分割
+			before := used - records[i].needSpaceLen(width) - width
+			if i > 0 && total-before < used {
+				index = i
+			}
+			break
+		}
+	}
+	return index
+}
+
 func (p *page) isNil() bool {
-	return p._indexByFlag2(flag2RecordBegin) == 0
+	return p._indexByFlag(flagRecordBegin) == 0
 }
 
 // splitFront 溢出前面record
-func (p *page) splitFront(key, value []byte) []*record {
+func (p *page) splitFront(r *record) []*record {
 	all := p.all()
-	all, _ = appendToSortedRecords(all, &record{Key: key, Value: value})
+	all, _ = appendToSortedRecords(all, r, p.compare)
 
 	p._reset()
 
-	var useSpace uint16 = 0
+	var useSpace uint32 = 0
 	overflow := make([]*record, 0, 10)
 	recordMaxSize := p._recordMaxSize()
 	for i := range all {
 		// i != len(all) 这里要保证，p不是一个空页
 		if useSpace < recordMaxSize && i != len(all)-1 {
 			overflow = append(overflow, all[i])
-			useSpace += all[i].needSpaceLen()
+			useSpace += all[i].needSpaceLen(p.width)
 		} else {
-			p.set(all[i].Key, all[i].Value)
+			p.setRecord(all[i])
 		}
 	}
 	return overflow
@@ -244,80 +368,47 @@ func (p *page) splitFront(key, value []byte) []*record {
 // splitBehind 分裂节点，溢出后面record
 // first return 溢出的记录
 // second return 新插入的记录位置是否在前置节点
-func (p *page) splitBehind(key, value []byte) ([]*record, bool) {
+func (p *page) splitBehind(r *record) ([]*record, bool) {
 	all := p.all()
-	all, _ = appendToSortedRecords(all, &record{Key: key, Value: value})
+	all, _ = appendToSortedRecords(all, r, p.compare)
 
 	p._reset()
 
-	var useSpace uint16 = 0
+	var useSpace uint32 = 0
 	overflow := make([]*record, 0, 10)
 	recordMaxSize := p._recordMaxSize()
 	for i := range all {
 		if useSpace < recordMaxSize {
-			p.set(all[i].Key, all[i].Value)
-			useSpace += all[i].needSpaceLen()
+			p.setRecord(all[i])
+			useSpace += all[i].needSpaceLen(p.width)
 		} else {
 			overflow = append(overflow, all[i])
 		}
 	}
 
 	isFront := true
-	if len(overflow) > 0 && bytes.Compare(key, overflow[0].Key) >= 0 {
+	if len(overflow) > 0 && p.compare(r.Key, overflow[0].Key) >= 0 {
 		isFront = false
 	}
 	return overflow, isFront
 }
 
-func (p *page) query(min, max []byte) []*record {
-	records := make([]*record, 0, 10)
-	_, r := p.find(min)
-	if r == nil {
-		recordBegin := p._indexByFlag2(flag2RecordBegin)
-		if recordBegin == 0 {
-			return nil
-		}
-		r = p._record(recordBegin)
-	}
-	for {
-		if r.match(min, max) {
-			records = append(records, r)
-		}
-		if r.next == 0 {
-			break
-		}
-		r = p._record(r.next)
-	}
-	return records
-}
-
-// find 查找key所在的directory以及record，record.key =< key
-// 页为空或或者key小于所有元素      dir == nil record == nil
-// 中间                         dir != nil record != nil
-// 大于所有元素                  dir == last_dir record == last record
-func (p *page) find(key []byte) (*dir, *record) {
-	dir := p._dirFind(key)
-	if dir == nil {
-		return nil, nil
+// find 查找key所在的slot以及record，record.key =< key
+// 页为空或者key小于所有元素      index == -1 record == nil
+// 其他                         record是小于等于key的最后一条记录，index是它的slot
+func (p *page) find(key []byte) (int, *record) {
+	index, found := p._dirSearch(key)
+	if !found {
+		index--
 	}
-
-	offset := dir.recordOffset
-	r := p._record(offset)
-
-	for {
-		if r.next == 0 {
-			return dir, r
-		}
-		next := p._record(r.next)
-		if bytes.Compare(next.Key, key) > 0 {
-			return dir, r
-		}
-		r = next
+	if index < 0 {
+		return -1, nil
 	}
+	return index, p._record(p._slot(index))
 }
 
 func (p *page) all() []*record {
-	offset := p._indexByFlag2(flag2RecordBegin)
+	offset := p._indexByFlag(flagRecordBegin)
 	if offset == 0 {
 		return nil
 	}
@@ -336,7 +427,7 @@ func (p *page) all() []*record {
 }
 
 func (p *page) count() int {
-	offset := p._indexByFlag2(flag2RecordBegin)
+	offset := p._indexByFlag(flagRecordBegin)
 	if offset == 0 {
 		return 0
 	}
@@ -354,12 +445,60 @@ func (p *page) count() int {
 	return num
 }
 
-func (p *page) _indexByFlag2(flag int) uint16 {
-	return binary.BigEndian.Uint16(p.buf[flag : flag+byte2])
+// checksum 计算页的crc32c校验和，不包括校验和本身所在的4个字节
+func checksum(buf []byte, at int) uint32 {
+	crc := crc32.Update(0, crcTable, buf[:at])
+	return crc32.Update(crc, crcTable, buf[at+4:])
+}
+
+func setChecksum(buf []byte, at int) {
+	binary.BigEndian.PutUint32(buf[at:], checksum(buf, at))
+}
+
+// verifyChecksum 校验页，从来没有写入过的页全部是0，也认为是合法的
+func verifyChecksum(buf []byte, at int) bool {
+	if binary.BigEndian.Uint32(buf[at:]) == checksum(buf, at) {
+		return true
+	}
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// _flagOffset 页头字段的位置，大页的字段在wideFlagBegin之后
+func (p *page) _flagOffset(flag int) uint32 {
+	if p.width == byte2 {
+		return uint32(flag)
+	}
+	return wideFlagBegin + uint32(flag-flagRecordBegin)*2
+}
+
+func (p *page) _indexByFlag(flag int) uint32 {
+	return p._uint(p._flagOffset(flag))
+}
+
+func (p *page) _setIndexByFlag(flag int, value uint32) {
+	p._putUint(p._flagOffset(flag), value)
+}
+
+// _uint 读取页内偏移量
+func (p *page) _uint(offset uint32) uint32 {
+	if p.width == byte2 {
+		return uint32(binary.BigEndian.Uint16(p.buf[offset:]))
+	}
+	return binary.BigEndian.Uint32(p.buf[offset:])
 }
 
-func (p *page) _setIndexByFlag2(flag int, value uint16) {
-	binary.BigEndian.PutUint16(p.buf[flag:flag+byte2], value)
+// _putUint 写入页内偏移量
+func (p *page) _putUint(offset, value uint32) {
+	if p.width == byte2 {
+		binary.BigEndian.PutUint16(p.buf[offset:], uint16(value))
+		return
+	}
+	binary.BigEndian.PutUint32(p.buf[offset:], value)
 }
 
 func (p *page) _indexByFlag8(flag int) uint64 {
@@ -370,38 +509,93 @@ func (p *page) _setIndexByFlag8(flag int, value uint64) {
 	binary.BigEndian.PutUint64(p.buf[flag:flag+byte8], value)
 }
 
-func (p *page) _recordMaxSize() uint16 {
-	return recordMaxSize(p.size)
+func (p *page) _recordMaxSize() uint32 {
+	return recordMaxSize(uint64(p.size))
 }
 
 func (p *page) _reset() {
-	p._setIndexByFlag2(flag2RecordBegin, 0)
-	p._setIndexByFlag2(flag2RecycleBegin, 0)
-	p._setIndexByFlag2(flag2FreeBegin, 0)
-	p._setIndexByFlag2(flag2DirBegin, 0)
+	p._setIndexByFlag(flagRecordBegin, 0)
+	p._setIndexByFlag(flagRecycleBegin, 0)
+	p._setIndexByFlag(flagFreeBegin, 0)
+	p._setIndexByFlag(flagDirBegin, 0)
+}
+
+// _isFragmented 空闲空间不够，但是加上回收空间就足够存储needSpaceLen大小的记录
+func (p *page) _isFragmented(needSpaceLen uint32) bool {
+	if p._indexByFlag(flagRecycleBegin) == 0 {
+		return false
+	}
+
+	// 新记录还需要一个slot
+	return recordsDefaultBegin+p._usedSpace()+needSpaceLen+p.width <= p.size
+}
+
+// _defragment 碎片整理，把所有记录连续地重新写入记录空间，然后重建目录
+func (p *page) _defragment() {
+	records := p.all()
+	p._reset()
+	if len(records) == 0 {
+		return
+	}
+
+	offset := uint32(recordsDefaultBegin)
+	for _, r := range records {
+		r.offset = offset
+		r.spaceLen = r.needSpaceLen(p.width)
+		offset += r.spaceLen
+	}
+	for i, r := range records {
+		if i > 0 {
+			r.pre = records[i-1].offset
+		} else {
+			r.pre = 0
+		}
+		if i < len(records)-1 {
+			r.next = records[i+1].offset
+		} else {
+			r.next = 0
+		}
+		p._setRecord(r)
+	}
+	p._setIndexByFlag(flagRecordBegin, recordsDefaultBegin)
+	p._setIndexByFlag(flagFreeBegin, offset)
+	p._dirRebuild()
 }
 
 // _recycle 回收record空间
 func (p *page) _recycle(record *record) {
-	recycleBegin := p._indexByFlag2(flag2RecycleBegin)
+	recycleBegin := p._indexByFlag(flagRecycleBegin)
 	record.next = recycleBegin
 	p._setRecord(record)
-	p._setIndexByFlag2(flag2RecycleBegin, record.offset)
+	p._setIndexByFlag(flagRecycleBegin, record.offset)
 }
 
-func (p *page) _setSpace(offset, spaceLen, nextIndex uint16) (uint16, uint16) {
-	binary.BigEndian.PutUint16(p.buf[offset:], spaceLen)
-	binary.BigEndian.PutUint16(p.buf[offset+2:], nextIndex)
+func (p *page) _setSpace(offset, spaceLen, nextIndex uint32) (uint32, uint32) {
+	p._putUint(offset, spaceLen)
+	p._putUint(offset+p.width, nextIndex)
 	return offset, offset + spaceLen
 }
 
-func (p *page) _getSpace(needSpaceLen uint16) (spaceOffset uint16, spaceLen uint16, ok bool) {
+// _getSpace 为新记录申请空间，同时保证目录还有一个slot的空间
+func (p *page) _getSpace(needSpaceLen uint32) (spaceOffset uint32, spaceLen uint32, ok bool) {
+	freeBegin := p._indexByFlag(flagFreeBegin)
+	if freeBegin == 0 {
+		freeBegin = recordsDefaultBegin
+	}
+	freeLen := p._dirBegin() - freeBegin
+	if freeLen < p.width {
+		return 0, 0, false
+	}
+
 	// 从回收空间获取
 	if spaceOffset, spaceLen, ok = p._getRecycleSpace(needSpaceLen); ok {
 		return
 	}
 
-	// 熊空闲空间获取
+	// 从空闲空间获取
+	if freeLen < needSpaceLen+p.width {
+		return 0, 0, false
+	}
 	if spaceOffset, spaceLen, ok = p._getFreeSpace(needSpaceLen); ok {
 		return
 	}
@@ -410,23 +604,23 @@ func (p *page) _getSpace(needSpaceLen uint16) (spaceOffset uint16, spaceLen uint
 	return
 }
 
-func (p *page) _getRecycleSpace(needSpaceLen uint16) (spaceOffset uint16, spaceLen uint16, ok bool) {
-	recycleBegin := p._indexByFlag2(flag2RecycleBegin)
+func (p *page) _getRecycleSpace(needSpaceLen uint32) (spaceOffset uint32, spaceLen uint32, ok bool) {
+	recycleBegin := p._indexByFlag(flagRecycleBegin)
 	if recycleBegin == 0 {
 		return 0, 0, false
 	}
 
 	var (
-		preOffset uint16 = 0
-		nextIndex uint16 = 0
+		preOffset uint32 = 0
+		nextIndex uint32 = 0
 	)
 
 	spaceOffset = recycleBegin
 	for {
 		// 读取spaceLen
-		spaceLen = binary.BigEndian.Uint16(p.buf[spaceOffset:])
+		spaceLen = p._uint(spaceOffset)
 		// 读取nextIndex
-		nextIndex = binary.BigEndian.Uint16(p.buf[spaceOffset+4:])
+		nextIndex = p._uint(spaceOffset + 2*p.width)
 
 		if spaceLen >= needSpaceLen {
 			break
@@ -441,22 +635,46 @@ func (p *page) _getRecycleSpace(needSpaceLen uint16) (spaceOffset uint16, spaceL
 
 	// 是第一个空闲空间
 	if preOffset == 0 {
-		p._setIndexByFlag2(flag2RecycleBegin, nextIndex)
-		ok = true
-		return
+		p._setIndexByFlag(flagRecycleBegin, nextIndex)
+	} else {
+		p._putUint(preOffset+2*p.width, nextIndex)
 	}
-	binary.BigEndian.PutUint16(p.buf[preOffset+4:], nextIndex)
+
+	spaceLen = p._splitSpace(spaceOffset, spaceLen, needSpaceLen)
 	ok = true
 	return
 }
 
-func (p *page) _getFreeSpace(needSpaceLen uint16) (spaceOffset uint16, spaceLen uint16, ok bool) {
-	freeBegin := p._indexByFlag2(flag2FreeBegin)
+// _splitSpace 记录只使用空间的前needSpaceLen，剩下的空间还能放下一条最短的记录时放回回收链表，返回记录占用的空间
+// 这样记录占用的空间和实际需要的空间相差不到一条最短的记录，_usedSpace才能接近真实的使用量
+func (p *page) _splitSpace(offset, spaceLen, needSpaceLen uint32) uint32 {
+	rest := spaceLen - needSpaceLen
+	if rest < 5*p.width {
+		return spaceLen
+	}
+	restOffset := offset + needSpaceLen
+	p._putUint(restOffset, rest)
+	p._putUint(restOffset+2*p.width, p._indexByFlag(flagRecycleBegin))
+	p._setIndexByFlag(flagRecycleBegin, restOffset)
+	return needSpaceLen
+}
+
+// _recycledBytes 页内回收链表中空间的总长度
+func (p *page) _recycledBytes() uint32 {
+	var total uint32
+	for offset := p._indexByFlag(flagRecycleBegin); offset != 0; offset = p._uint(offset + 2*p.width) {
+		total += p._uint(offset)
+	}
+	return total
+}
+
+func (p *page) _getFreeSpace(needSpaceLen uint32) (spaceOffset uint32, spaceLen uint32, ok bool) {
+	freeBegin := p._indexByFlag(flagFreeBegin)
 	if freeBegin == 0 {
 		freeBegin = recordsDefaultBegin
 	}
 
-	dirBegin := p._indexByFlag2(flag2DirBegin)
+	dirBegin := p._indexByFlag(flagDirBegin)
 	if dirBegin == 0 {
 		dirBegin = p.size
 	}
@@ -467,7 +685,7 @@ func (p *page) _getFreeSpace(needSpaceLen uint16) (spaceOffset uint16, spaceLen
 		return
 	}
 
-	p._setIndexByFlag2(flag2FreeBegin, freeBegin+needSpaceLen)
+	p._setIndexByFlag(flagFreeBegin, freeBegin+needSpaceLen)
 	return freeBegin, needSpaceLen, true
 }
 
@@ -475,48 +693,56 @@ func (p *page) _getFreeSpace(needSpaceLen uint16) (spaceOffset uint16, spaceLen
 func (p *page) _setRecord(record *record) {
 	offset := record.offset
 	// 设置spaceLen
-	binary.BigEndian.PutUint16(p.buf[offset:], record.spaceLen)
+	p._putUint(offset, record.spaceLen)
 	// 设置pre
-	offset += 2
-	binary.BigEndian.PutUint16(p.buf[offset:], record.pre)
+	offset += p.width
+	p._putUint(offset, record.pre)
 	// 设置next
-	offset += 2
-	binary.BigEndian.PutUint16(p.buf[offset:], record.next)
+	offset += p.width
+	p._putUint(offset, record.next)
 	// 设置keyLen
-	offset += 2
-	binary.BigEndian.PutUint16(p.buf[offset:], uint16(len(record.Key)))
+	offset += p.width
+	p._putUint(offset, uint32(len(record.Key)))
 	// 设置valueLen
-	offset += 2
-	binary.BigEndian.PutUint16(p.buf[offset:], uint16(len(record.Value)))
+	offset += p.width
+	valueLen := uint32(len(record.Value))
+	if record.isOverflow {
+		valueLen |= valueOverflowFlag(p.width)
+	}
+	p._putUint(offset, valueLen)
 	// 设置key
-	offset += 2
+	offset += p.width
 	copy(p.buf[offset:], record.Key)
 	// 设置value
-	offset += uint16(len(record.Key))
+	offset += uint32(len(record.Key))
 	copy(p.buf[offset:], record.Value)
 }
 
 // _record 在指定偏移位置
-func (p *page) _record(offset uint16) *record {
+func (p *page) _record(offset uint32) *record {
 	var record record
 	record.offset = offset
 
 	// 读取spaceLen
-	record.spaceLen = binary.BigEndian.Uint16(p.buf[offset:])
+	record.spaceLen = p._uint(offset)
 	// 读取pre
-	offset += 2
-	record.pre = binary.BigEndian.Uint16(p.buf[offset:])
+	offset += p.width
+	record.pre = p._uint(offset)
 	// 读取next
-	offset += 2
-	record.next = binary.BigEndian.Uint16(p.buf[offset:])
+	offset += p.width
+	record.next = p._uint(offset)
 	// 读取keyLen
-	offset += 2
-	keyLen := binary.BigEndian.Uint16(p.buf[offset:])
+	offset += p.width
+	keyLen := p._uint(offset)
 	// 读取valueLen
-	offset += 2
-	valueLen := binary.BigEndian.Uint16(p.buf[offset:])
+	offset += p.width
+	valueLen := p._uint(offset)
+	if flag := valueOverflowFlag(p.width); valueLen&flag != 0 {
+		record.isOverflow = true
+		valueLen &^= flag
+	}
 	// 读取key
-	offset += 2
+	offset += p.width
 	record.Key = make([]byte, keyLen)
 	copy(record.Key, p.buf[offset:offset+keyLen])
 	// 读取value
@@ -534,7 +760,7 @@ func (p *page) _deleteRecord(r record) {
 		pre.next = r.next
 		p._setRecord(pre)
 	} else {
-		p._setIndexByFlag2(flag2RecordBegin, r.next)
+		p._setIndexByFlag(flagRecordBegin, r.next)
 	}
 
 	if r.next != 0 {
@@ -11,18 +11,25 @@ import (
 	"time"
 )
 
-func Test_page_indexFlag2(t *testing.T) {
-	page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
-	pageType := page.pageType()
-	if pageType != pageTypeLeaf {
-		t.Fatalf("index != 1, index:%d", pageType)
-	}
+func Test_page_indexFlag(t *testing.T) {
+	for _, pageSize := range []int{defaultPageSize, 1 << 20} {
+		page := newPage(make([]byte, pageSize), 0, pageTypeLeaf)
+		pageType := page.pageType()
+		if pageType != pageTypeLeaf {
+			t.Fatalf("index != 1, index:%d", pageType)
+		}
 
-	flag := flag2RecordBegin
-	page._setIndexByFlag2(flag, 1)
-	index := page._indexByFlag2(flag)
-	if index != 1 {
-		t.Fatalf("index != 1, index:%d", index)
+		flag := flagRecordBegin
+		page._setIndexByFlag(flag, 1)
+		index := page._indexByFlag(flag)
+		if index != 1 {
+			t.Fatalf("index != 1, index:%d", index)
+		}
+
+		page._setIndexByFlag(flagDirBegin, page.size)
+		if page._indexByFlag(flagDirBegin) != page.size || page._indexByFlag(flagFreeBegin) != 0 {
+			t.Fatal(page._indexByFlag(flagDirBegin))
+		}
 	}
 }
 
@@ -115,7 +122,7 @@ func Test_page_set_increment(t *testing.T) {
 
 		allDir := page._dirAll()
 		dirIsSort := sort.SliceIsSorted(allDir, func(i, j int) bool {
-			return bytes.Compare(allDir[i].key, allDir[j].key) < 0
+			return bytes.Compare(page._key(allDir[i]), page._key(allDir[j])) < 0
 		})
 		//if !dirIsSort {
 		t.Log("add:", i)
@@ -135,7 +142,7 @@ func Test_page_getFreeSpace(t *testing.T) {
 	for i := 0; i < 450; i++ {
 		spaceOffset, spaceLen, ok := p._getFreeSpace(10)
 		if i < 403 {
-			if spaceOffset != recordsDefaultBegin+uint16(i)*10 || spaceLen != 10 || !ok {
+			if spaceOffset != recordsDefaultBegin+uint32(i)*10 || spaceLen != 10 || !ok {
 				t.Fatalf("spaceOffset error index:%d spaceOffset:%d spaceLen:%d ok:%v", i, spaceOffset, spaceLen, ok)
 			}
 		} else {
@@ -148,17 +155,17 @@ func Test_page_getFreeSpace(t *testing.T) {
 
 func Test_page_getRecycleSpace1(t *testing.T) {
 	p := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
-	offset := uint16(recordsDefaultBegin)
+	offset := uint32(recordsDefaultBegin)
 	offset, next := p._setSpace(offset, 12, 0)
 	offset, next = p._setSpace(next, 11, offset)
 	offset, next = p._setSpace(next, 10, offset)
-	p._setIndexByFlag2(flag2RecycleBegin, offset)
+	p._setIndexByFlag(flagRecycleBegin, offset)
 
 	tests := []struct {
 		name            string
-		needSpaceLen    uint16
-		wantSpaceOffset uint16
-		wantSpaceLen    uint16
+		needSpaceLen    uint32
+		wantSpaceOffset uint32
+		wantSpaceLen    uint32
 		wantOk          bool
 	}{
 		{
@@ -286,7 +293,7 @@ func Test_page_splitFront(t *testing.T) {
 	}
 	for i := range args {
 		page := initSpitPage()
-		records := page.splitFront([]byte(args[i]), []byte(args[i]))
+		records := page.splitFront(&record{Key: []byte(args[i]), Value: []byte(args[i])})
 		if !isSorted(records) || !isSorted(page.all()) {
 			t.Fatalf("is not sorted, args:%s", args[i])
 		}
@@ -312,54 +319,13 @@ func Test_page_splitBehind(t *testing.T) {
 
 	for i := range args {
 		page := initSpitPage()
-		records, isFront := page.splitBehind([]byte(args[i]), []byte(args[i]))
+		records, isFront := page.splitBehind(&record{Key: []byte(args[i]), Value: []byte(args[i])})
 		if !isSorted(records) || !isSorted(page.all()) {
 			t.Fatalf("is not sorted, args:%s isFront:%v", args[i], isFront)
 		}
 	}
 }
 
-func Test_page_query(t *testing.T) {
-	page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
-	for i := 1; i < 10; i++ {
-		buf := []byte(strconv.Itoa(i))
-		page.set(buf, buf)
-	}
-
-	type args struct {
-		min []byte
-		max []byte
-	}
-	tests := []struct {
-		name string
-		args args
-		want []*record
-	}{
-		{
-			args: args{min: toBytes(0), max: toBytes(2)},
-			want: []*record{
-				{Key: toBytes(1), Value: toBytes(1)},
-				{Key: toBytes(2), Value: toBytes(2)},
-			},
-		},
-		{
-			args: args{min: toBytes(1), max: toBytes(2)},
-			want: []*record{
-				{Key: toBytes(1), Value: toBytes(1)},
-				{Key: toBytes(2), Value: toBytes(2)},
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			gots := page.query(tt.args.min, tt.args.max)
-			if !isEqualRecords(gots, tt.want) {
-				t.Fatal(string(tt.args.min), string(tt.args.max), gots)
-			}
-		})
-	}
-}
-
 func Test_page_count(t *testing.T) {
 	page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
 	for i := 1; i < 10; i++ {
@@ -428,3 +394,64 @@ func Test_page_complex_rand(t *testing.T) {
 		}
 	}
 }
+
+func Test_page_defragment(t *testing.T) {
+	page := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
+	mock := newRecordList()
+	for i := 0; ; i++ {
+		key := []byte(fmt.Sprintf("%4d", i))
+		if _, isEnoughSpace := page.set(key, key); !isEnoughSpace {
+			break
+		}
+		mock.set(&record{Key: key, Value: key})
+	}
+
+	// 删除一半的记录，回收的空间都太小，不能存储更大的记录
+	var deleted [][]byte
+	for i := 0; i < len(mock.list); i += 2 {
+		deleted = append(deleted, mock.list[i].Key)
+	}
+	for _, key := range deleted {
+		page.delete(key)
+		mock.delete(key)
+	}
+
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("%4d", i*2))
+		_, isEnoughSpace := page.set(key, value)
+		if !isEnoughSpace {
+			t.Fatal(i)
+		}
+		mock.set(&record{Key: key, Value: value})
+	}
+	mock.assertMatch(t, page.all(), nil)
+	if page._indexByFlag(flagRecycleBegin) != 0 {
+		t.Fatal(page._indexByFlag(flagRecycleBegin))
+	}
+	for _, r := range mock.list {
+		if v, ok := page.get(r.Key); !ok || !bytes.Equal(v, r.Value) {
+			t.Fatal(string(r.Key))
+		}
+	}
+}
+
+func Test_page_usedSpace(t *testing.T) {
+	p := newPage(make([]byte, defaultPageSize), 0, pageTypeLeaf)
+	rand.Seed(time.Now().Unix())
+	for i := 0; i < 10000; i++ {
+		key := toBytes(rand.Intn(100))
+		if rand.Intn(3) == 0 {
+			p.delete(key)
+		} else {
+			p.set(key, bytes.Repeat([]byte{1}, rand.Intn(50)))
+		}
+
+		// 记录复用回收空间或者原地更新时，最多多占用不到一条最短记录的空间
+		all := p.all()
+		used, want := p._usedSpace(), usedSpace(all, p.width)
+		if used < want || used > want+uint32(len(all))*5*p.width {
+			t.Fatal(i, used, want, len(all))
+		}
+	}
+}
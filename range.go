@@ -0,0 +1,116 @@
+package mydb
+
+import "bytes"
+
+// RangeOptions 范围查询的选项，零值表示按key从小到大返回[min, max]之间的所有记录
+type RangeOptions struct {
+	Limit        int  // 最多返回的记录数，小于等于0表示不限制
+	Reverse      bool // 按key从大到小返回
+	MinExclusive bool // 不包含等于min的记录
+	MaxExclusive bool // 不包含等于max的记录
+}
+
+// RangeWithOptions 按opts查询min和max之间的记录，min或max为Infinity表示这一边没有边界
+// 比如分页查询cursor之后的50条记录：RangeWithOptions(cursor, Infinity, RangeOptions{Limit: 50, MinExclusive: true})
+func (m *DB) RangeWithOptions(min, max []byte, opts RangeOptions) (kvs []KV, err error) {
+	err = m.View(func(tx *Tx) error {
+		kvs, err = tx.RangeWithOptions(min, max, opts)
+		return err
+	})
+	return
+}
+
+func (tx *Tx) RangeWithOptions(min, max []byte, opts RangeOptions) ([]KV, error) {
+	err := tx.check(false)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := tx.db.tree.rangeRecords(min, max, opts)
+	if err != nil {
+		return nil, err
+	}
+	return toKVs(records), nil
+}
+
+// rangeRecords 从一端的边界定位到第一条记录，然后沿着叶子页链表遍历，超出另一端的边界或者达到Limit时停止
+func (b *tree) rangeRecords(min, max []byte, opts RangeOptions) ([]*record, error) {
+	c := &Cursor{tree: b}
+	var key, value []byte
+	if opts.Reverse {
+		key, value = c.seekMax(max, opts.MaxExclusive)
+	} else {
+		key, value = c.seekMin(min, opts.MinExclusive)
+	}
+
+	var records []*record
+	for key != nil {
+		if opts.Reverse && !b._isAfterMin(key, min, opts.MinExclusive) ||
+			!opts.Reverse && !b._isBeforeMax(key, max, opts.MaxExclusive) {
+			break
+		}
+		records = append(records, &record{Key: key, Value: value})
+		if opts.Limit > 0 && len(records) >= opts.Limit {
+			break
+		}
+
+		if opts.Reverse {
+			key, value = c.Prev()
+		} else {
+			key, value = c.Next()
+		}
+	}
+	if c.Err() != nil {
+		return nil, c.Err()
+	}
+	return records, nil
+}
+
+// _isAfterMin key是否在min的右边
+func (b *tree) _isAfterMin(key, min []byte, exclusive bool) bool {
+	if bytes.Equal(min, Infinity) {
+		return true
+	}
+	result := b.fm.comparator.compare(key, min)
+	return result > 0 || result == 0 && !exclusive
+}
+
+// _isBeforeMax key是否在max的左边
+func (b *tree) _isBeforeMax(key, max []byte, exclusive bool) bool {
+	if bytes.Equal(max, Infinity) {
+		return true
+	}
+	result := b.fm.comparator.compare(key, max)
+	return result < 0 || result == 0 && !exclusive
+}
+
+// seekMin 定位到第一条在min右边的记录
+func (c *Cursor) seekMin(min []byte, exclusive bool) ([]byte, []byte) {
+	if bytes.Equal(min, Infinity) {
+		return c.First()
+	}
+	key, value := c.Seek(min)
+	if key != nil && !c.tree._isAfterMin(key, min, exclusive) {
+		return c.Next()
+	}
+	return key, value
+}
+
+// seekMax 定位到最后一条在max左边的记录
+func (c *Cursor) seekMax(max []byte, exclusive bool) ([]byte, []byte) {
+	if bytes.Equal(max, Infinity) {
+		return c.Last()
+	}
+	key, value := c.Seek(max)
+	if key == nil {
+		if c.err != nil {
+			return nil, nil
+		}
+		// 所有记录都小于max
+		return c.Last()
+	}
+	if !c.tree._isBeforeMax(key, max, exclusive) {
+		return c.Prev()
+	}
+	return key, value
+}
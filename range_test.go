@@ -0,0 +1,155 @@
+package mydb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRangeWithOptions(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	// 0,2,4...1998
+	var keys []string
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 2000; i += 2 {
+			key := fmt.Sprintf("%4d", i)
+			keys = append(keys, key)
+			_, _ = tx.Set([]byte(key), []byte(key))
+		}
+		return nil
+	})
+
+	// expect 按选项直接过滤keys
+	expect := func(min, max string, opts RangeOptions) []string {
+		var result []string
+		for _, key := range keys {
+			if min != "" && (key < min || opts.MinExclusive && key == min) {
+				continue
+			}
+			if max != "" && (key > max || opts.MaxExclusive && key == max) {
+				continue
+			}
+			result = append(result, key)
+		}
+		if opts.Reverse {
+			for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+				result[i], result[j] = result[j], result[i]
+			}
+		}
+		if opts.Limit > 0 && len(result) > opts.Limit {
+			result = result[:opts.Limit]
+		}
+		return result
+	}
+
+	bounds := []string{"", fmt.Sprintf("%4d", 0), fmt.Sprintf("%4d", 501), fmt.Sprintf("%4d", 1000),
+		fmt.Sprintf("%4d", 1998), fmt.Sprintf("%4d", 1999), "   ", "9999"}
+	for _, min := range bounds {
+		for _, max := range bounds {
+			for flag := 0; flag < 16; flag++ {
+				opts := RangeOptions{
+					Reverse:      flag&1 != 0,
+					MinExclusive: flag&2 != 0,
+					MaxExclusive: flag&4 != 0,
+				}
+				if flag&8 != 0 {
+					opts.Limit = 50
+				}
+
+				kvs, err := db.RangeWithOptions([]byte(min), []byte(max), opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := expect(min, max, opts)
+				if len(kvs) != len(want) {
+					t.Fatalf("min:%q max:%q opts:%+v got:%d want:%d", min, max, opts, len(kvs), len(want))
+				}
+				for i := range kvs {
+					if string(kvs[i].Key) != want[i] {
+						t.Fatalf("min:%q max:%q opts:%+v i:%d got:%s want:%s", min, max, opts, i, kvs[i].Key, want[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRangeWithOptions_page(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("%4d", i))
+			_, _ = tx.Set(key, key)
+		}
+		return nil
+	})
+
+	// 每次取cursor之后的50条
+	var num int
+	cursor := Infinity
+	for {
+		kvs, err := db.RangeWithOptions(cursor, Infinity, RangeOptions{Limit: 50, MinExclusive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kvs) == 0 {
+			break
+		}
+		for _, kv := range kvs {
+			if string(kv.Key) != fmt.Sprintf("%4d", num) {
+				t.Fatal(num, string(kv.Key))
+			}
+			num++
+		}
+		cursor = kvs[len(kvs)-1].Key
+	}
+	if num != 1000 {
+		t.Fatal(num)
+	}
+}
+
+func Test_tree_rangeRecords(t *testing.T) {
+	tree := newDefaultTree()
+	defer tree.fm.close()
+	for i := 1; i < 10; i++ {
+		buf := toBytes(i)
+		_, _ = tree.set(buf, buf)
+	}
+
+	tests := []struct {
+		min, max []byte
+		opts     RangeOptions
+		want     []*record
+	}{
+		{
+			min: toBytes(0), max: toBytes(2),
+			want: []*record{
+				{Key: toBytes(1), Value: toBytes(1)},
+				{Key: toBytes(2), Value: toBytes(2)},
+			},
+		},
+		{
+			min: toBytes(1), max: toBytes(2),
+			want: []*record{
+				{Key: toBytes(1), Value: toBytes(1)},
+				{Key: toBytes(2), Value: toBytes(2)},
+			},
+		},
+		{
+			min: toBytes(1), max: toBytes(3), opts: RangeOptions{MinExclusive: true, Reverse: true},
+			want: []*record{
+				{Key: toBytes(3), Value: toBytes(3)},
+				{Key: toBytes(2), Value: toBytes(2)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		gots, err := tree.rangeRecords(tt.min, tt.max, tt.opts)
+		if err != nil || !isEqualRecords(gots, tt.want) {
+			t.Fatal(string(tt.min), string(tt.max), gots, err)
+		}
+	}
+}
@@ -14,38 +14,46 @@ spaceLen 空间大小
 pre      上一个记录位置
 next     下一个记录位置
 keyLen   key的长度
-valueLen value的长度
+valueLen value的长度，最高位为1表示value存储在溢出页中，value是指向溢出页的指针
 key      key
 value    value
+spaceLen、pre、next、keyLen、valueLen的字节数由页大小决定，见offsetLen
 */
 
+// valueOverflowFlag valueLen的最高位，页内的value不会超过页大小的一半，不会用到最高位
+func valueOverflowFlag(width uint32) uint32 {
+	return 1 << (width*8 - 1)
+}
+
 // record 记录
 type record struct {
 	Key        []byte
 	Value      []byte
-	spaceLen   uint16
-	pre        uint16
-	next       uint16
-	offset     uint16
+	spaceLen   uint32
+	pre        uint32
+	next       uint32
+	offset     uint32
 	pageOffset uint64
+	isOverflow bool // value存储在溢出页中
 }
 
-func recordMaxSize(pageSize uint16) uint16 {
-	return (pageSize - recordsDefaultBegin) / 2
+func recordMaxSize(pageSize uint64) uint32 {
+	return uint32(pageSize-recordsDefaultBegin) / 2
 }
 
-func (r *record) match(min, max []byte) bool {
-	if !bytes.Equal(min, Infinity) && bytes.Compare(min, r.Key) > 0 {
+func (r *record) match(min, max []byte, compare func(a, b []byte) int) bool {
+	if !bytes.Equal(min, Infinity) && compare(min, r.Key) > 0 {
 		return false
 	}
-	if !bytes.Equal(max, Infinity) && bytes.Compare(max, r.Key) < 0 {
+	if !bytes.Equal(max, Infinity) && compare(max, r.Key) < 0 {
 		return false
 	}
 	return true
 }
 
-func (r *record) needSpaceLen() uint16 {
-	return uint16(10) + uint16(len(r.Key)+len(r.Value))
+// needSpaceLen 记录需要的空间，width是页内偏移量的字节数
+func (r *record) needSpaceLen(width uint32) uint32 {
+	return 5*width + uint32(len(r.Key)+len(r.Value))
 }
 
 func (r *record) child() uint64 {
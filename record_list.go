@@ -14,7 +14,8 @@ func toBytes(i int) []byte {
 }
 
 type recordList struct {
-	list []*record
+	list    []*record
+	compare func(a, b []byte) int // key的比较器，为nil时按字节比较
 }
 
 func newRecordList(list ...[]*record) *recordList {
@@ -24,12 +25,25 @@ func newRecordList(list ...[]*record) *recordList {
 	return &recordList{}
 }
 
-func (l *recordList) set(r *record) bool {
+func (l *recordList) _compare(a, b []byte) int {
+	if l.compare == nil {
+		return bytes.Compare(a, b)
+	}
+	return l.compare(a, b)
+}
+
+// _search 查找第一个key大于等于key的位置，以及key是否存在
+func (l *recordList) _search(key []byte) (int, bool) {
 	index := sort.Search(len(l.list), func(i int) bool {
-		return bytes.Compare(l.list[i].Key, r.Key) >= 0
+		return l._compare(l.list[i].Key, key) >= 0
 	})
+	return index, index < len(l.list) && l._compare(l.list[index].Key, key) == 0
+}
+
+func (l *recordList) set(r *record) bool {
+	index, ok := l._search(r.Key)
 	// 不存在
-	if index >= len(l.list) || !bytes.Equal(l.list[index].Key, r.Key) {
+	if !ok {
 		l.list = append(l.list, r)
 		for i := len(l.list) - 1; i > index; i-- {
 			l.list[i] = l.list[i-1]
@@ -43,10 +57,8 @@ func (l *recordList) set(r *record) bool {
 }
 
 func (l *recordList) delete(key []byte) bool {
-	index := sort.Search(len(l.list), func(i int) bool {
-		return bytes.Compare(l.list[i].Key, key) >= 0
-	})
-	if index >= len(l.list) || !bytes.Equal(l.list[index].Key, key) {
+	index, ok := l._search(key)
+	if !ok {
 		return false
 	}
 
@@ -55,10 +67,8 @@ func (l *recordList) delete(key []byte) bool {
 }
 
 func (l *recordList) get(key []byte) *record {
-	index := sort.Search(len(l.list), func(i int) bool {
-		return bytes.Compare(l.list[i].Key, key) >= 0
-	})
-	if index >= len(l.list) || !bytes.Equal(l.list[index].Key, key) {
+	index, ok := l._search(key)
+	if !ok {
 		return nil
 	}
 	return l.list[index]
@@ -108,11 +118,12 @@ func isEqualRecords(r1, r2 []*record) bool {
 	return true
 }
 
-func appendToSortedRecords(l []*record, r *record) ([]*record, bool) {
+// appendToSortedRecords 按compare的顺序插入r，key已经存在时不插入
+func appendToSortedRecords(l []*record, r *record, compare func(a, b []byte) int) ([]*record, bool) {
 	index := sort.Search(len(l), func(i int) bool {
-		return bytes.Compare(l[i].Key, r.Key) >= 0
+		return compare(l[i].Key, r.Key) >= 0
 	})
-	if index < len(l) && bytes.Equal(l[index].Key, r.Key) {
+	if index < len(l) && compare(l[index].Key, r.Key) == 0 {
 		return l, false
 	}
 
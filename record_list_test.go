@@ -45,7 +45,7 @@ func Test_appendToSortedRecords(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got, _ := appendToSortedRecords(tt.args.l, tt.args.r); !isSorted(got) {
+			if got, _ := appendToSortedRecords(tt.args.l, tt.args.r, bytes.Compare); !isSorted(got) {
 				t.Errorf("appendToSortedRecords() = %v", got)
 			}
 		})
@@ -1,6 +1,9 @@
 package mydb
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 func Test_record_match(t *testing.T) {
 	type fields struct {
@@ -40,7 +43,7 @@ func Test_record_match(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &record{Key: tt.fields.Key}
-			if got := r.match(tt.args.min, tt.args.max); got != tt.want {
+			if got := r.match(tt.args.min, tt.args.max, bytes.Compare); got != tt.want {
 				t.Errorf("record:%s min:%s min:%s result = %v, want %v",
 					string(tt.fields.Key), string(tt.args.min), string(tt.args.max), got, tt.want)
 			}
@@ -0,0 +1,87 @@
+package mydb
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrStopScan Scan的回调返回ErrStopScan时停止遍历，Scan返回nil
+var ErrStopScan = errors.New("stop scan")
+
+// Scan 按key从小到大遍历[min, max]之间的记录，min或max为Infinity表示这一边没有边界
+// key和value直接引用映射中的页，只在回调中有效，不能修改，需要保留时要复制
+// 除了value存储在溢出页中的记录，遍历时不会为每条记录申请内存
+// 回调返回error时停止遍历，并返回这个error，返回ErrStopScan时Scan返回nil
+func (m *DB) Scan(min, max []byte, fn func(key, value []byte) error) error {
+	return m.View(func(tx *Tx) error {
+		return tx.Scan(min, max, fn)
+	})
+}
+
+func (tx *Tx) Scan(min, max []byte, fn func(key, value []byte) error) error {
+	err := tx.check(false)
+	if err != nil {
+		return err
+	}
+
+	err = tx.db.tree.scan(min, max, fn)
+	if err == ErrStopScan {
+		return nil
+	}
+	return err
+}
+
+// scan 沿着slot的顺序遍历叶子页，不创建record
+func (b *tree) scan(min, max []byte, fn func(key, value []byte) error) error {
+	var page *page
+	var err error
+	index := 0
+	if !bytes.Equal(min, Infinity) {
+		page, err = b._getLeafPage(min)
+		if err != nil {
+			return err
+		}
+		if page != nil {
+			index, _ = page._dirSearch(min)
+		}
+	}
+	if page == nil {
+		page, err = b.fm.frontPage()
+		if err != nil {
+			return err
+		}
+	}
+
+	hasMax := !bytes.Equal(max, Infinity)
+	compare := b.fm.comparator.compare
+	for {
+		for num := page._dirNum(); index < num; index++ {
+			offset := page._slot(index)
+			key := page._key(offset)
+			if hasMax && compare(key, max) > 0 {
+				return nil
+			}
+
+			value, isOverflow := page._value(offset)
+			if isOverflow {
+				value, err = b.readOverflow(value)
+				if err != nil {
+					return err
+				}
+			}
+			err = fn(key, value)
+			if err != nil {
+				return err
+			}
+		}
+
+		if page.next() == 0 {
+			return nil
+		}
+		page, err = b.fm.page(page.next())
+		if err != nil {
+			return err
+		}
+		index = 0
+	}
+}
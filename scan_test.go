@@ -0,0 +1,93 @@
+package mydb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 10000; i += 2 {
+			key := []byte(fmt.Sprintf("%6d", i))
+			value := key
+			if i%1000 == 0 {
+				value = largeValue(i, 10000)
+			}
+			_, _ = tx.Set(key, value)
+		}
+		return nil
+	})
+
+	bounds := [][]byte{Infinity, []byte(fmt.Sprintf("%6d", 0)), []byte(fmt.Sprintf("%6d", 3001)),
+		[]byte(fmt.Sprintf("%6d", 5000)), []byte(fmt.Sprintf("%6d", 9999)), []byte("   "), []byte("a")}
+	for _, min := range bounds {
+		for _, max := range bounds {
+			kvs, err := db.Range(min, max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			i := 0
+			err = db.Scan(min, max, func(key, value []byte) error {
+				if i >= len(kvs) || !bytes.Equal(key, kvs[i].Key) || !bytes.Equal(value, kvs[i].Value) {
+					t.Fatal(string(min), string(max), i, string(key))
+				}
+				i++
+				return nil
+			})
+			if err != nil || i != len(kvs) {
+				t.Fatal(string(min), string(max), i, len(kvs), err)
+			}
+		}
+	}
+
+	// 提前停止
+	num := 0
+	err := db.Scan(Infinity, Infinity, func(key, value []byte) error {
+		num++
+		if num == 10 {
+			return ErrStopScan
+		}
+		return nil
+	})
+	if err != nil || num != 10 {
+		t.Fatal(num, err)
+	}
+	errTest := errors.New("test")
+	err = db.Scan(Infinity, Infinity, func(key, value []byte) error {
+		return errTest
+	})
+	if err != errTest {
+		t.Fatal(err)
+	}
+}
+
+func TestScan_allocs(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < 10000; i++ {
+			key := []byte(fmt.Sprintf("%6d", i))
+			_, _ = tx.Set(key, key)
+		}
+		return nil
+	})
+
+	// 每个页只申请常数次内存，和记录数无关
+	num := 0
+	allocs := testing.AllocsPerRun(10, func() {
+		_ = db.Scan(Infinity, Infinity, func(key, value []byte) error {
+			num++
+			return nil
+		})
+	})
+	result, _ := db.tree.fm.statisticsPage()
+	if num != 110000 || allocs > float64(result.leafPageNum*2+10) {
+		t.Fatal(num, allocs, result.leafPageNum)
+	}
+}
@@ -0,0 +1,156 @@
+package mydb
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Stats 数据库文件的统计信息，用来监控空间膨胀和决定什么时候Compact
+type Stats struct {
+	FileSize        uint64 // 文件大小，单位字节
+	PageSize        uint64
+	PageNum         uint64 // 文件中的页数，包括meta页
+	BranchPageNum   int
+	LeafPageNum     int
+	RecyclePageNum  int // 已经回收等待复用的页数
+	OverflowPageNum int
+	FreeListLen     int // 回收页链表的长度，正常情况下和RecyclePageNum相等
+
+	Depth        int   // b+树的层数
+	LevelPageNum []int // 每一层的页数，LevelPageNum[0]是根页所在的层，最后一层是叶子层
+	RecordNum    int
+
+	LeafFillPercent float64 // 叶子页中记录和目录占用的空间占页容量的平均百分比
+	RecycledBytes   uint64  // 枝干页和叶子页中删除记录后回收、还没有复用的空间，也就是页内碎片
+
+	KeySize   SizeStats
+	ValueSize SizeStats // 存储在溢出页中的value按实际长度统计
+}
+
+// SizeStats 长度的分布
+// Histogram[i]是长度在[2^(i-1), 2^i)之间的个数，Histogram[0]是长度为0的个数
+type SizeStats struct {
+	Min       int
+	Max       int
+	Avg       float64
+	Histogram []int
+	total     int
+	num       int
+}
+
+func (s *SizeStats) add(size int) {
+	if s.num == 0 || size < s.Min {
+		s.Min = size
+	}
+	if size > s.Max {
+		s.Max = size
+	}
+	s.total += size
+	s.num++
+
+	i := bits.Len(uint(size))
+	for len(s.Histogram) <= i {
+		s.Histogram = append(s.Histogram, 0)
+	}
+	s.Histogram[i]++
+}
+
+func (s *SizeStats) finish() {
+	if s.num > 0 {
+		s.Avg = float64(s.total) / float64(s.num)
+	}
+}
+
+// Stats 统计数据库文件，会读取文件中所有的页，只适合在后台低频调用
+func (m *DB) Stats() (stats Stats, err error) {
+	err = m.View(func(tx *Tx) error {
+		stats, err = tx.Stats()
+		return err
+	})
+	return
+}
+
+func (tx *Tx) Stats() (Stats, error) {
+	err := tx.check(false)
+	if err != nil {
+		return Stats{}, err
+	}
+	return tx.db.tree.stats()
+}
+
+// stats 按页类型的统计来自statisticsPage，其余的从根页开始逐层遍历
+func (b *tree) stats() (Stats, error) {
+	result, err := b.fm.statisticsPage()
+	if err != nil {
+		return Stats{}, err
+	}
+	recycled, err := b.fm.recycledPages()
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{
+		FileSize:        result.fileSize,
+		PageSize:        result.pageSize,
+		PageNum:         result.totalPageNum,
+		BranchPageNum:   result.branchPageNum,
+		LeafPageNum:     result.leafPageNum,
+		RecyclePageNum:  result.recyclePageNum,
+		OverflowPageNum: result.overflowPageNum,
+		FreeListLen:     len(recycled),
+	}
+
+	root, err := b.fm.rootPage()
+	if err != nil {
+		return Stats{}, err
+	}
+	var fill float64
+	level := []*page{root}
+	for len(level) > 0 {
+		stats.LevelPageNum = append(stats.LevelPageNum, len(level))
+
+		var next []*page
+		for _, page := range level {
+			stats.RecycledBytes += uint64(page._recycledBytes())
+			if page.pageType() == pageTypeLeaf {
+				fill += float64(b._leafStats(page, &stats)) / float64(page.capacity())
+				continue
+			}
+			for i := 0; i < page._dirNum(); i++ {
+				child, err := b.fm.page(page._child(i))
+				if err != nil {
+					return Stats{}, err
+				}
+				next = append(next, child)
+			}
+		}
+		level = next
+	}
+	stats.Depth = len(stats.LevelPageNum)
+	if n := stats.LevelPageNum[stats.Depth-1]; n > 0 {
+		stats.LeafFillPercent = fill / float64(n) * 100
+	}
+	stats.KeySize.finish()
+	stats.ValueSize.finish()
+	return stats, nil
+}
+
+// _leafStats 统计叶子页中记录的key和value长度，返回记录和目录占用的空间
+func (b *tree) _leafStats(page *page, stats *Stats) uint32 {
+	var used uint32
+	for i := 0; i < page._dirNum(); i++ {
+		offset := page._slot(i)
+		key := page._key(offset)
+		value, isOverflow := page._value(offset)
+		r := record{Key: key, Value: value}
+		used += r.needSpaceLen(page.width) + page.width
+
+		valueLen := len(value)
+		if isOverflow {
+			valueLen = int(binary.BigEndian.Uint64(value[8:]))
+		}
+		stats.KeySize.add(len(key))
+		stats.ValueSize.add(valueLen)
+		stats.RecordNum++
+	}
+	return used
+}
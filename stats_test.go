@@ -0,0 +1,74 @@
+package mydb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	const count = 20000
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < count; i++ {
+			key := []byte(fmt.Sprintf("%8d", i))
+			value := key
+			if i%1000 == 1 {
+				value = largeValue(i, 10000)
+			}
+			_, _ = tx.Set(key, value)
+		}
+		return nil
+	})
+	// 删除一部分记录，产生页内碎片和回收页
+	_ = db.Update(func(tx *Tx) error {
+		for i := 0; i < count; i += 3 {
+			_ = tx.Delete([]byte(fmt.Sprintf("%8d", i)))
+		}
+		return nil
+	})
+	_, _ = db.DeleteRange([]byte(fmt.Sprintf("%8d", 5000)), []byte(fmt.Sprintf("%8d", 9999)))
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", stats)
+
+	num, _ := db.Count(Infinity, Infinity)
+	if stats.RecordNum != num {
+		t.Fatal(stats.RecordNum, num)
+	}
+	if stats.Depth != len(stats.LevelPageNum) || stats.LevelPageNum[0] != 1 ||
+		stats.LevelPageNum[stats.Depth-1] != stats.LeafPageNum {
+		t.Fatal(stats.Depth, stats.LevelPageNum, stats.LeafPageNum)
+	}
+	pageNum := 0
+	for _, n := range stats.LevelPageNum {
+		pageNum += n
+	}
+	if pageNum != stats.BranchPageNum+stats.LeafPageNum {
+		t.Fatal(pageNum, stats.BranchPageNum, stats.LeafPageNum)
+	}
+	if stats.FreeListLen != stats.RecyclePageNum || stats.RecyclePageNum == 0 {
+		t.Fatal(stats.FreeListLen, stats.RecyclePageNum)
+	}
+	if stats.RecycledBytes == 0 || stats.LeafFillPercent <= 0 || stats.LeafFillPercent > 100 {
+		t.Fatal(stats.RecycledBytes, stats.LeafFillPercent)
+	}
+
+	if stats.KeySize.Min != 8 || stats.KeySize.Max != 8 || stats.KeySize.Avg != 8 || stats.KeySize.Histogram[4] != num {
+		t.Fatalf("%+v", stats.KeySize)
+	}
+	if stats.ValueSize.Min != 8 || stats.ValueSize.Max != 10000 || stats.ValueSize.Histogram[14] == 0 {
+		t.Fatalf("%+v", stats.ValueSize)
+	}
+	total := 0
+	for _, n := range stats.ValueSize.Histogram {
+		total += n
+	}
+	if total != num {
+		t.Fatal(total, num)
+	}
+}
@@ -16,91 +16,186 @@ func newTree(fm *fileManager) *tree {
 }
 
 // set 设置，返回是否是一个新的记录
-func (b *tree) set(key, value []byte) (isNew bool) {
-	isNew = true
+func (b *tree) set(key, value []byte) (isNew bool, err error) {
+	r, err := b.newRecord(key, value)
+	if err != nil {
+		return
+	}
+	return b._put(r)
+}
 
-	leafPage := b._getLeafPage(key)
+// newRecord 创建要写入叶子页的记录，value太大时存储到溢出页，记录中只保存溢出页指针
+func (b *tree) newRecord(key, value []byte) (*record, error) {
+	r := &record{Key: key, Value: value}
+	if b.isOverflow(key, value) {
+		pointer, err := b.writeOverflow(value)
+		if err != nil {
+			return nil, err
+		}
+		r.Value = pointer
+		r.isOverflow = true
+	}
+	return r, nil
+}
+
+// _put 将记录写入叶子页，value已经处理过溢出页
+func (b *tree) _put(r *record) (isNew bool, err error) {
+	leafPage, err := b._getLeafPage(r.Key)
+	if err != nil {
+		return
+	}
+	isNew, _, err = b._putToLeaf(leafPage, r)
+	return
+}
+
+// _putToLeaf 将记录写入leafPage，isSplit表示树的结构是否发生了变化
+func (b *tree) _putToLeaf(leafPage *page, r *record) (isNew bool, isSplit bool, err error) {
+	isNew = true
 	if leafPage != nil {
+		// 覆盖时回收旧的溢出页
+		old := leafPage.getRecord(r.Key)
+		if old != nil && old.isOverflow {
+			err = b.freeOverflow(old.Value)
+			if err != nil {
+				return
+			}
+		}
+
 		var isEnoughSpace bool
-		isNew, isEnoughSpace = leafPage.set(key, value)
+		isNew, isEnoughSpace = leafPage.setRecord(r)
 		if isEnoughSpace {
 			return
 		}
 	}
 
-	b._add(leafPage, key, value)
+	isSplit = true
+	err = b._add(leafPage, r)
 	return
 }
 
 // _add 添加
-func (b *tree) _add(leafPage *page, key, value []byte) bool {
+func (b *tree) _add(leafPage *page, r *record) error {
 	if leafPage == nil {
-		front := b.fm.frontPage()
-		_, isEnoughSpace := front.set(key, value)
+		front, err := b.fm.frontPage()
+		if err != nil {
+			return err
+		}
+		_, isEnoughSpace := front.setRecord(r)
 		if isEnoughSpace {
 			// 叶子节点不分裂,添加，并且更新枝干节点最小值
-			b._addToPageParentFront(front, nil)
-		} else {
-			// 叶子节点需要分裂
-			newPage := b.fm.allocatePage(pageTypeLeaf)
-			newPage.set(key, value)
-
-			newPage.setNext(front.offset)
-			front.setPre(front.offset)
-
-			b.fm.setFront(newPage.offset)
-			b._addToPageParentFront(front, newPage)
-		}
-		return true
-	} else {
-		_, isEnoughSpace := leafPage.set(key, value)
-		if !isEnoughSpace {
-			records, _ := leafPage.splitBehind(key, value)
-			if len(records) == 0 {
-				return true
-			}
+			return b._addToPageParentFront(front, nil)
+		}
 
-			newPage := b.fm.allocatePage(pageTypeLeaf)
-			for i := range records {
-				newPage.set(records[i].Key, records[i].Value)
-			}
+		// 叶子节点需要分裂
+		newPage, err := b.fm.allocatePage(pageTypeLeaf)
+		if err != nil {
+			return err
+		}
+		newPage.setRecord(r)
+
+		newPage.setNext(front.offset)
+		front.setPre(newPage.offset)
+
+		b.fm.setFront(newPage.offset)
+		return b._addToPageParentFront(front, newPage)
+	}
+
+	_, isEnoughSpace := leafPage.setRecord(r)
+	if isEnoughSpace {
+		return nil
+	}
+
+	records, _ := leafPage.splitBehind(r)
+	if len(records) == 0 {
+		return nil
+	}
+
+	newPage, err := b.fm.allocatePage(pageTypeLeaf)
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		newPage.setRecord(records[i])
+	}
 
-			newPage.setPre(leafPage.pre())
-			newPage.setNext(leafPage.next())
+	newPage.setPre(leafPage.offset)
+	newPage.setNext(leafPage.next())
 
-			leafPage.setPre(newPage.offset)
-			leafPage.setNext(newPage.offset)
-			b._addToPageParentBehind(leafPage, newPage)
+	if leafPage.next() != 0 {
+		next, err := b.fm.page(leafPage.next())
+		if err != nil {
+			return err
 		}
-		return true
+		next.setPre(newPage.offset)
 	}
+	leafPage.setNext(newPage.offset)
+	return b._addToPageParentBehind(leafPage, newPage)
 }
 
-// _getLeafPage 获取叶子页
-func (b *tree) _getLeafPage(key []byte) *page {
-	front := b.fm.frontPage()
-	if bytes.Compare(key, front.min()) < 0 {
-		return nil
+// _getLeafPage 获取叶子页，key小于所有记录时返回nil
+func (b *tree) _getLeafPage(key []byte) (*page, error) {
+	page, _, err := b._getLeafPageBound(key)
+	return page, err
+}
+
+// _getLeafPageBound 获取叶子页，同时返回叶子页key的上界，小于上界的key都在这个叶子页中，上界为nil表示没有上界
+func (b *tree) _getLeafPageBound(key []byte) (*page, []byte, error) {
+	front, err := b.fm.frontPage()
+	if err != nil {
+		return nil, nil, err
+	}
+	// 空树也返回front，比较器不需要处理空的key
+	if !front.isNil() && b.fm.comparator.compare(key, front.min()) < 0 {
+		return nil, nil, nil
 	}
 
-	page := b.fm.rootPage()
+	page, err := b.fm.rootPage()
+	if err != nil {
+		return nil, nil, err
+	}
+	var upper []byte
 	for page.pageType() != pageTypeLeaf {
-		_, pre := page.find(key)
-		page = b.fm.page(pre.child())
+		index, pre := page.find(key)
+		if pre == nil {
+			return nil, nil, b.fm.corrupted(page.offset)
+		}
+		// 越往下的上界越小
+		if index+1 < page._dirNum() {
+			upper = append([]byte(nil), page._key(page._slot(index+1))...)
+		}
+		page, err = b.fm.page(pre.child())
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	return page
+	return page, upper, nil
+}
+
+// _setParent 更新records中所有子页的父节点
+func (b *tree) _setParent(records []*record, parent uint64) error {
+	for i := range records {
+		page, err := b.fm.page(records[i].child())
+		if err != nil {
+			return err
+		}
+		page.setParent(parent)
+	}
+	return nil
 }
 
 // _addToPageParentFront 添加addedPage到page页的parent页， page.min() > addedPage.min()
-func (b *tree) _addToPageParentFront(page, addedPage *page) {
+func (b *tree) _addToPageParentFront(page, addedPage *page) error {
 	for {
 		parentOffset := page.parent()
 		if parentOffset == 0 && addedPage == nil {
-			break
+			return nil
 		}
 
 		if addedPage == nil {
-			parent := b.fm.page(parentOffset)
+			parent, err := b.fm.page(parentOffset)
+			if err != nil {
+				return err
+			}
 			pageMin := page.min()
 			isEnoughSpace := parent.updateMinKey(pageMin)
 			if isEnoughSpace {
@@ -108,14 +203,18 @@ func (b *tree) _addToPageParentFront(page, addedPage *page) {
 				addedPage = nil
 			} else {
 				parent.delete(pageMin)
-				records := parent.splitFront(addedPage.min(), addedPage.offsetBuf())
+				records := parent.splitFront(&record{Key: addedPage.min(), Value: addedPage.offsetBuf()})
 
-				newPage := b.fm.allocatePage(pageTypeBranch)
+				newPage, err := b.fm.allocatePage(pageTypeBranch)
+				if err != nil {
+					return err
+				}
 				for i := range records {
 					newPage.set(records[i].Key, records[i].Value)
-
-					page := b.fm.page(records[i].child())
-					page.setParent(newPage.offset)
+				}
+				err = b._setParent(records, newPage.offset)
+				if err != nil {
+					return err
 				}
 
 				page = parent
@@ -126,17 +225,23 @@ func (b *tree) _addToPageParentFront(page, addedPage *page) {
 
 		if parentOffset == 0 {
 			// root 节点需要分裂
-			newPage := b.fm.allocatePage(pageTypeBranch)
+			newPage, err := b.fm.allocatePage(pageTypeBranch)
+			if err != nil {
+				return err
+			}
 			newPage.set(addedPage.min(), addedPage.offsetBuf())
 			newPage.set(page.min(), page.offsetBuf())
 
 			page.setParent(newPage.offset)
 			addedPage.setParent(newPage.offset)
 			b.fm.setRoot(newPage.offset)
-			break
+			return nil
 		}
 
-		parent := b.fm.page(parentOffset)
+		parent, err := b.fm.page(parentOffset)
+		if err != nil {
+			return err
+		}
 		_, isEnoughSpace := parent.set(addedPage.min(), addedPage.offsetBuf())
 		if isEnoughSpace {
 			addedPage.setParent(parentOffset)
@@ -146,7 +251,10 @@ func (b *tree) _addToPageParentFront(page, addedPage *page) {
 			addedPage = nil
 		} else {
 			// 枝干节点节点需要分裂
-			newPage := b.fm.allocatePage(pageTypeBranch)
+			newPage, err := b.fm.allocatePage(pageTypeBranch)
+			if err != nil {
+				return err
+			}
 			newPage.set(addedPage.min(), addedPage.offsetBuf())
 			addedPage.setParent(newPage.offset)
 
@@ -157,42 +265,52 @@ func (b *tree) _addToPageParentFront(page, addedPage *page) {
 }
 
 // _addToPageParentBehind 将addedPage节点添加到page的parent节点，page.min() < addedPage.min()
-func (b *tree) _addToPageParentBehind(page, addedPage *page) {
+func (b *tree) _addToPageParentBehind(page, addedPage *page) error {
 	for {
 		parentOffset := page.parent()
 		if parentOffset == 0 {
 			// page是根节点
-			newPage := b.fm.allocatePage(pageTypeBranch)
+			newPage, err := b.fm.allocatePage(pageTypeBranch)
+			if err != nil {
+				return err
+			}
 			newPage.set(page.min(), page.offsetBuf())
 			newPage.set(addedPage.min(), addedPage.offsetBuf())
 
 			page.setParent(newPage.offset)
 			addedPage.setParent(newPage.offset)
 			b.fm.setRoot(newPage.offset)
-			return
+			return nil
 		}
 
 		// node是非根节点
-		parent := b.fm.page(parentOffset)
+		parent, err := b.fm.page(parentOffset)
+		if err != nil {
+			return err
+		}
 		_, isEnoughSpace := parent.set(addedPage.min(), addedPage.offsetBuf())
 		if isEnoughSpace {
 			// parent没有分裂
 			addedPage.setParent(parentOffset)
-			return
+			return nil
 		}
 		// parent分裂,
 		// 这里不一定要指向新节点
-		records, isFront := parent.splitBehind(addedPage.min(), addedPage.offsetBuf())
+		records, isFront := parent.splitBehind(&record{Key: addedPage.min(), Value: addedPage.offsetBuf()})
 		if len(records) == 0 {
-			return
+			return nil
 		}
 
-		newPage := b.fm.allocatePage(pageTypeBranch)
+		newPage, err := b.fm.allocatePage(pageTypeBranch)
+		if err != nil {
+			return err
+		}
 		for i := range records {
 			newPage.set(records[i].Key, records[i].Value)
-
-			page := b.fm.page(records[i].child())
-			page.setParent(newPage.offset)
+		}
+		err = b._setParent(records, newPage.offset)
+		if err != nil {
+			return err
 		}
 
 		if isFront {
@@ -206,141 +324,251 @@ func (b *tree) _addToPageParentBehind(page, addedPage *page) {
 	}
 }
 
-// delete 如果没有数据了，需要删除节点
-func (b *tree) delete(key []byte) bool {
-	if bytes.Compare(key, b.fm.frontPage().min()) < 0 {
-		return false
+// delete 删除记录，页的空间使用率过低时与兄弟页合并或者从兄弟页借用记录
+func (b *tree) delete(key []byte) (bool, error) {
+	leafNode, err := b._getLeafPage(key)
+	if err != nil || leafNode == nil {
+		return false, err
 	}
+	ok, _, err := b._deleteFromLeaf(leafNode, key)
+	return ok, err
+}
 
-	leafNode := b._getLeafPage(key)
-	ok := leafNode.delete(key)
-	if !ok {
-		return false
+// _deleteFromLeaf 从leafNode中删除记录，isRebalanced表示树的结构是否可能发生了变化
+func (b *tree) _deleteFromLeaf(leafNode *page, key []byte) (ok bool, isRebalanced bool, err error) {
+	r := leafNode.getRecord(key)
+	if r == nil {
+		return false, false, nil
 	}
-
-	if !leafNode.isNil() {
-		return true
+	if r.isOverflow {
+		err = b.freeOverflow(r.Value)
+		if err != nil {
+			return false, false, err
+		}
 	}
+	leafNode.delete(key)
 
-	// 这里应该回收节点
-	// 处理叶子节点
-	// 是front节点
-	if leafNode.pre() == 0 {
-		b.fm.setFront(leafNode.next())
-	} else {
-		b.fm.page(leafNode.pre()).setNext(leafNode.next())
+	if leafNode.parent() == 0 || !leafNode.isUnderflow() {
+		return true, false, nil
 	}
-	// 回收叶子节点
-	b.fm.recycle(leafNode)
-
-	// 处理枝干节点
-	// 父节点不为nil,需要删除在父节点的位置
-	if leafNode.parent() == 0 {
-		return true
+	err = b._rebalance(leafNode)
+	if err != nil {
+		return false, true, err
 	}
-	parent := b.fm.page(leafNode.parent())
-	for {
-		parent.delete(key)
-		if !parent.isNil() {
-			break
-		}
-		parent = b.fm.page(parent.parent())
-	}
-	return true
+	return true, true, nil
 }
 
-func (b *tree) get(key []byte) ([]byte, bool) {
-	leafPage := b._getLeafPage(key)
-	if leafPage == nil {
-		return nil, false
-	}
+// _rebalance 从page开始向上处理空间使用率过低的页，最后折叠只有一个子页的根节点
+func (b *tree) _rebalance(page *page) error {
+	for page.parent() != 0 {
+		if !page.isUnderflow() {
+			return nil
+		}
 
-	return leafPage.get(key)
-}
+		parent, err := b.fm.page(page.parent())
+		if err != nil {
+			return err
+		}
+		records, index, err := b._childIndex(parent, page.offset)
+		if err != nil {
+			return err
+		}
+		// 没有兄弟页，交给父页处理
+		if len(records) == 1 {
+			page = parent
+			continue
+		}
 
-func (b *tree) query(min, max []byte) []*record {
-	if bytes.Equal(min, Infinity) && bytes.Equal(max, Infinity) {
-		return b.all()
-	}
+		// 总是保留左边的页，这样父页中左边页的分隔key和front都不需要修改
+		left, separator := page, records[index]
+		if index > 0 {
+			left, err = b.fm.page(records[index-1].child())
+		} else {
+			separator = records[index+1]
+		}
+		if err != nil {
+			return err
+		}
+		right, err := b.fm.page(separator.child())
+		if err != nil {
+			return err
+		}
 
-	if bytes.Equal(min, Infinity) {
-		page := b._getLeafPage(max)
-		if page == nil {
-			return nil
+		isMerged, err := b._merge(parent, left, right, separator.Key)
+		if err != nil || !isMerged {
+			return err
 		}
+		page = parent
+	}
+	return b._collapseRoot(page)
+}
 
-		var records []*record
-		for {
-			result := page.query(min, max)
-			if len(result) == 0 {
-				return records
+// _merge 合并left和right两个相邻的兄弟页，空间不够合并时在两个页之间重新分配记录
+// separator right在父页中的分隔key
+func (b *tree) _merge(parent, left, right *page, separator []byte) (isMerged bool, err error) {
+	all := append(left.all(), right.all()...)
+	if usedSpace(all, left.width)*4 <= left.capacity()*3 {
+		if !left.rebuild(all) {
+			return false, b.fm.corrupted(left.offset)
+		}
+		if left.pageType() == pageTypeBranch {
+			err = b._setParent(all, left.offset)
+			if err != nil {
+				return false, err
 			}
-			records = append(records, result...)
-
-			if page.pre() == 0 {
-				break
+		} else {
+			left.setNext(right.next())
+			if right.next() != 0 {
+				next, err := b.fm.page(right.next())
+				if err != nil {
+					return false, err
+				}
+				next.setPre(left.offset)
 			}
-			page = b.fm.page(page.pre())
 		}
-		return records
+
+		parent.delete(separator)
+		b.fm.recycle(right)
+		return true, nil
 	}
 
-	page := b._getLeafPage(min)
-	if page == nil {
-		return nil
+	index := splitIndex(all, left.width)
+	if !left.rebuild(all[:index]) || !right.rebuild(all[index:]) {
+		return false, b.fm.corrupted(left.offset)
+	}
+	if left.pageType() == pageTypeBranch {
+		err = b._setParent(all[:index], left.offset)
+		if err != nil {
+			return false, err
+		}
+		err = b._setParent(all[index:], right.offset)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	var records []*record
-	for {
-		result := page.query(min, max)
-		if len(result) == 0 {
-			return records
+	// 更新right在父页中的分隔key，父页空间不够时会分裂
+	if bytes.Equal(separator, right.min()) {
+		return false, nil
+	}
+	parent.delete(separator)
+	return false, b._addToPageParentBehind(left, right)
+}
+
+// _collapseRoot 根节点是只有一个子页的枝干节点时，用子页作为新的根节点
+func (b *tree) _collapseRoot(root *page) error {
+	for root.pageType() == pageTypeBranch && root.count() == 1 {
+		child, err := b.fm.page(root.first().child())
+		if err != nil {
+			return err
 		}
-		records = append(records, result...)
+		child.setParent(0)
+		b.fm.setRoot(child.offset)
+		b.fm.recycle(root)
+		root = child
+	}
+	return nil
+}
 
-		if page.next() == 0 {
-			break
+// _childIndex 子页在父页中的位置
+func (b *tree) _childIndex(parent *page, offset uint64) ([]*record, int, error) {
+	records := parent.all()
+	for i := range records {
+		if records[i].child() == offset {
+			return records, i, nil
 		}
-		page = b.fm.page(page.next())
 	}
-	return records
+	return nil, 0, b.fm.corrupted(parent.offset)
 }
 
-func (b *tree) all() []*record {
+func (b *tree) get(key []byte) ([]byte, bool, error) {
+	leafPage, err := b._getLeafPage(key)
+	if err != nil || leafPage == nil {
+		return nil, false, err
+	}
+
+	r := leafPage.getRecord(key)
+	if r == nil {
+		return nil, false, nil
+	}
+	value, err := b.value(r)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// query 按key的顺序查询[min, max]之间的记录，溢出页中的value会被读取出来
+func (b *tree) query(min, max []byte) ([]*record, error) {
+	return b.rangeRecords(min, max, RangeOptions{})
+}
+
+// all 查询所有记录，溢出页中的value会被读取出来
+func (b *tree) all() ([]*record, error) {
+	records, err := b._all()
+	if err != nil {
+		return nil, err
+	}
+	err = b.resolve(records)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (b *tree) _all() ([]*record, error) {
 	cns := make([]*record, 0, 100)
 
-	page := b.fm.frontPage()
+	page, err := b.fm.frontPage()
+	if err != nil {
+		return nil, err
+	}
 	for {
 		cns = append(cns, page.all()...)
 
 		if page.next() == 0 {
 			break
 		}
-		page = b.fm.page(page.next())
+		page, err = b.fm.page(page.next())
+		if err != nil {
+			return nil, err
+		}
 	}
-	return cns
+	return cns, nil
 }
 
-func (b *tree) count() int {
+func (b *tree) count() (int, error) {
 	count := 0
 
-	page := b.fm.frontPage()
+	page, err := b.fm.frontPage()
+	if err != nil {
+		return 0, err
+	}
 	for {
 		count += page.count()
 
 		if page.next() == 0 {
 			break
 		}
-		page = b.fm.page(page.next())
+		page, err = b.fm.page(page.next())
+		if err != nil {
+			return 0, err
+		}
 	}
-	return count
+	return count, nil
 }
 
 func (b *tree) _display() {
 	splitPage := &page{}
 
+	root, err := b.fm.rootPage()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	queue := NewQueue[page]()
-	queue.Push(b.fm.rootPage())
+	queue.Push(root)
 	queue.Push(splitPage)
 
 	page := queue.Pop()
@@ -362,7 +590,12 @@ func (b *tree) _display() {
 		if page.pageType() == pageTypeBranch {
 			cns := page.all()
 			for i := range cns {
-				queue.Push(b.fm.page(cns[i].child()))
+				child, err := b.fm.page(cns[i].child())
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				queue.Push(child)
 			}
 		}
 
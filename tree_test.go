@@ -13,7 +13,8 @@ import (
 func newDefaultTree() *tree {
 	name := "data.txt"
 	os.Remove(name)
-	fm, err := newFileManager(name, defaultPageSize)
+	os.Remove(name + ".wal")
+	fm, err := newFileManager(name, getOptions())
 	if err != nil {
 		panic(err)
 	}
@@ -44,7 +45,7 @@ func Test_tree_fuzz(t *testing.T) {
 
 		if count%100000 == 0 {
 			t.Log(count)
-			mock.assertMatch(t, tree.all(), nil)
+			mock.assertMatch(t, tree.mustAll(), nil)
 			t.Log(tree.fm.statisticsPage())
 		}
 		count++
@@ -72,7 +73,7 @@ func Test_tree_complex_rand(t *testing.T) {
 	const count = 100000
 
 	tree := newDefaultTree()
-	defer tree.fm.file.Close()
+	defer tree.fm.close()
 
 	mock := newRecordList()
 
@@ -93,7 +94,8 @@ func Test_tree_complex_rand(t *testing.T) {
 		}
 	}
 
-	mock.assertMatch(t, tree.all(), nil)
+	mock.assertMatch(t, tree.mustAll(), nil)
+	checkTree(t, tree)
 	t.Log(tree.fm.statisticsPage())
 }
 
@@ -111,14 +113,14 @@ func Test_tree_add_rand(t *testing.T) {
 
 		r := toBytes(rand.Intn(1000000000000000000))
 
-		isNew := tree.set(r, r)
+		isNew, _ := tree.set(r, r)
 		mockIsNew := mock.set(&record{Key: r, Value: r})
 		if isNew != mockIsNew {
 			t.Fatal()
 		}
 	}
 
-	all := tree.all()
+	all := tree.mustAll()
 	mock.assertMatch(t, all, nil)
 	t.Log(tree.fm.statisticsPage())
 }
@@ -137,7 +139,7 @@ func Test_tree_add_head(t *testing.T) {
 		mock.set(&record{Key: data, Value: data})
 	}
 
-	mock.assertMatch(t, tree.all(), nil)
+	mock.assertMatch(t, tree.mustAll(), nil)
 	t.Log(tree.fm.statisticsPage())
 }
 
@@ -147,7 +149,7 @@ func Test_tree_add_hea2(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		tree.set(toBytes(i), toBytes(i))
 
-		sorted := isSorted(tree.all())
+		sorted := isSorted(tree.mustAll())
 		if !sorted {
 			t.Fatal("err")
 		}
@@ -156,7 +158,7 @@ func Test_tree_add_hea2(t *testing.T) {
 	for i := 101; i < 110; i++ {
 		tree.set(toBytes(i), toBytes(i))
 
-		sorted := isSorted(tree.all())
+		sorted := isSorted(tree.mustAll())
 		if !sorted {
 			t.Fatal("err")
 		}
@@ -177,7 +179,7 @@ func Test_tree_add_tail(t *testing.T) {
 		mock.set(&record{Key: data, Value: data})
 	}
 
-	mock.assertMatch(t, tree.all(), nil)
+	mock.assertMatch(t, tree.mustAll(), nil)
 	t.Log(tree.fm.statisticsPage())
 }
 
@@ -200,7 +202,15 @@ func Test_tree_add_central(t *testing.T) {
 
 		mock.set(&record{Key: data, Value: data})
 	}
-	mock.assertMatch(t, tree.all(), nil)
+	mock.assertMatch(t, tree.mustAll(), nil)
+}
+
+func (b *tree) mustAll() []*record {
+	all, err := b.all()
+	if err != nil {
+		panic(err)
+	}
+	return all
 }
 
 func newDefaultTreeWithData() *tree {
@@ -219,7 +229,7 @@ func Test_tree_update(t *testing.T) {
 	value := []byte(fmt.Sprintf("%1d", 100))
 	tree.set(key, value)
 
-	result, ok := tree.get(key)
+	result, ok, _ := tree.get(key)
 	if !ok || !bytes.Equal(result, value) {
 		t.Fatal()
 	}
@@ -229,12 +239,12 @@ func Test_tree_delete(t *testing.T) {
 	tree := newDefaultTreeWithData()
 
 	key := []byte(fmt.Sprintf("%6d", 1))
-	ok := tree.delete(key)
+	ok, _ := tree.delete(key)
 	if !ok {
 		t.Fatal()
 	}
 
-	_, ok = tree.get(key)
+	_, ok, _ = tree.get(key)
 	if ok {
 		t.Fatal()
 	}
@@ -243,19 +253,19 @@ func Test_tree_delete(t *testing.T) {
 func Test_tree_query(t *testing.T) {
 	tree := newDefaultTreeWithData()
 
-	result := tree.query(Infinity, []byte(fmt.Sprintf("%6d", 2)))
+	result, _ := tree.query(Infinity, []byte(fmt.Sprintf("%6d", 2)))
 	t.Log(result)
 	if len(result) != 3 {
 		t.Fatal()
 	}
 
-	result = tree.query([]byte(fmt.Sprintf("%6d", 4997)), Infinity)
+	result, _ = tree.query([]byte(fmt.Sprintf("%6d", 4997)), Infinity)
 	t.Log(result)
 	if len(result) != 3 {
 		t.Fatal()
 	}
 
-	result = tree.query([]byte(fmt.Sprintf("%6d", 4990)), []byte(fmt.Sprintf("%6d", 4993)))
+	result, _ = tree.query([]byte(fmt.Sprintf("%6d", 4990)), []byte(fmt.Sprintf("%6d", 4993)))
 	t.Log(result)
 	if len(result) != 4 {
 		t.Fatal()
@@ -279,7 +289,7 @@ func Test_tree_count(t *testing.T) {
 		tree.set(data, data)
 	}
 
-	num := tree.count()
+	num, _ := tree.count()
 	if num != 100 {
 		t.Fatal(num)
 	}
@@ -287,6 +297,7 @@ func Test_tree_count(t *testing.T) {
 
 // old 14345
 // new 36205
+// 页目录二分查找 64409 -> 373981
 func Test_tree_get_init_data(t *testing.T) {
 	tree := newDefaultTree()
 	now := time.Now()
@@ -301,15 +312,54 @@ func Test_tree_get_init_data(t *testing.T) {
 
 	t.Logf("cost:%v tps:%v", time.Since(now), 1000000/time.Since(now).Seconds())
 	t.Log(tree.fm.statisticsPage())
+	_ = tree.fm.close()
 }
 
 // old 26573
 // new 45018
+// 页目录二分查找 7106ns/op -> 2426ns/op
 func Benchmark_tree_get(b *testing.B) {
-	fm, err := newFileManager("data.txt", defaultPageSize)
+	fm, err := newFileManager("data.txt", getOptions())
 	if err != nil {
 		panic(err)
 	}
+	defer fm.close()
+	tree := newTree(fm)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.get([]byte(strconv.Itoa(rand.Intn(1000000))))
+	}
+}
+
+// Test_tree_get_init_data_64KB 为Benchmark_tree_get_64KB准备64KB页的数据
+func Test_tree_get_init_data_64KB(t *testing.T) {
+	name := "data64k.txt"
+	os.Remove(name)
+	os.Remove(name + ".wal")
+	fm, err := newFileManager(name, getOptions(WithPageSize(64<<10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := newTree(fm)
+	now := time.Now()
+	for i := 1; i <= 1000000; i++ {
+		data := []byte(strconv.Itoa(i))
+		_, _ = tree.set(data, data)
+	}
+
+	t.Logf("cost:%v tps:%v", time.Since(now), 1000000/time.Since(now).Seconds())
+	t.Log(tree.fm.statisticsPage())
+	_ = tree.fm.close()
+}
+
+// 页目录二分查找 17127ns/op -> 2485ns/op
+func Benchmark_tree_get_64KB(b *testing.B) {
+	fm, err := newFileManager("data64k.txt", getOptions(WithPageSize(64<<10)))
+	if err != nil {
+		panic(err)
+	}
+	defer fm.close()
 	tree := newTree(fm)
 
 	b.ResetTimer()
@@ -321,3 +371,125 @@ func Benchmark_tree_get(b *testing.B) {
 func TestTime(t *testing.T) {
 	fmt.Println(int(time.Second / 23364))
 }
+
+// checkTree 检查树的结构：父节点指针、分隔key、叶子页链表
+func checkTree(t *testing.T, tree *tree) {
+	root, err := tree.fm.rootPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.parent() != 0 {
+		t.Fatal("root parent", root.parent())
+	}
+
+	var leaves []uint64
+	var walk func(page *page, min []byte)
+	walk = func(page *page, min []byte) {
+		if page.pageType() == pageTypeLeaf {
+			if !page.isNil() && min != nil && tree.fm.comparator.compare(page.min(), min) < 0 {
+				t.Fatal("leaf min", string(page.min()), string(min))
+			}
+			leaves = append(leaves, page.offset)
+			return
+		}
+		records := page.all()
+		if len(records) == 0 {
+			t.Fatal("empty branch", page.offset)
+		}
+		for i := range records {
+			child, err := tree.fm.page(records[i].child())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if child.parent() != page.offset {
+				t.Fatal("parent", child.offset, child.parent(), page.offset)
+			}
+			walk(child, records[i].Key)
+		}
+	}
+	walk(root, nil)
+
+	front, err := tree.fm.frontPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pre := uint64(0)
+	page := front
+	for i := range leaves {
+		if page.offset != leaves[i] || page.pre() != pre {
+			t.Fatal("leaf link", i, page.offset, leaves[i])
+		}
+		pre = page.offset
+		if page.next() != 0 {
+			page, _ = tree.fm.page(page.next())
+		}
+	}
+	if page.next() != 0 {
+		t.Fatal("leaf link next", page.next())
+	}
+}
+
+func Test_tree_delete_rebalance(t *testing.T) {
+	seed := time.Now().Unix()
+	t.Log("seed", seed)
+	rand.Seed(seed)
+
+	tree := newDefaultTree()
+	defer tree.fm.close()
+	mock := newRecordList()
+
+	const count = 20000
+	for i := 0; i < count; i++ {
+		data := []byte(fmt.Sprintf("%8d", i))
+		tree.set(data, data)
+		mock.set(&record{Key: data, Value: data})
+	}
+	before, err := tree.fm.statisticsPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除80%的记录
+	for _, i := range rand.Perm(count)[:count*8/10] {
+		key := []byte(fmt.Sprintf("%8d", i))
+		ok, err := tree.delete(key)
+		if err != nil || !ok {
+			t.Fatal(i, ok, err)
+		}
+		mock.delete(key)
+	}
+	mock.assertMatch(t, tree.mustAll(), nil)
+	checkTree(t, tree)
+
+	after, err := tree.fm.statisticsPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(before)
+	t.Log(after)
+	if after.leafPageNum*2 > before.leafPageNum {
+		t.Fatal(after.leafPageNum, before.leafPageNum)
+	}
+
+	// 删除所有记录后，根节点是一个空的叶子页
+	for _, r := range tree.mustAll() {
+		if ok, err := tree.delete(r.Key); err != nil || !ok {
+			t.Fatal(string(r.Key), ok, err)
+		}
+	}
+	checkTree(t, tree)
+	root, _ := tree.fm.rootPage()
+	if root.pageType() != pageTypeLeaf || !root.isNil() {
+		t.Fatal(root.pageType())
+	}
+
+	// 重新写入
+	for i := 0; i < count; i++ {
+		data := []byte(fmt.Sprintf("%8d", i))
+		tree.set(data, data)
+	}
+	checkTree(t, tree)
+	if num, _ := tree.count(); num != count {
+		t.Fatal(num)
+	}
+}
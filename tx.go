@@ -0,0 +1,140 @@
+package mydb
+
+import "errors"
+
+var (
+	ErrTxNotWritable = errors.New("error tx not writable")
+	ErrTxClosed      = errors.New("error tx closed")
+)
+
+// Tx 事务，只能在Update或者View的回调中使用
+// 读写事务中的所有修改在回调返回nil时原子提交，回调返回error时全部回滚
+// 读写事务中任何一个操作返回error（比如ErrDiskFull）时，应该返回error回滚事务
+type Tx struct {
+	db       *DB
+	writable bool
+	closed   bool
+}
+
+// Update 执行读写事务
+func (m *DB) Update(fn func(tx *Tx) error) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	fm := m.tree.fm
+	fm.begin()
+	tx := &Tx{db: m, writable: true}
+	defer func() {
+		// 回调panic时回滚
+		tx.closed = true
+		if fm.tx != nil {
+			fm.rollback()
+		}
+	}()
+
+	err := fn(tx)
+	tx.closed = true
+	if err != nil {
+		fm.rollback()
+		return err
+	}
+	return fm.commit()
+}
+
+// View 执行只读事务
+func (m *DB) View(fn func(tx *Tx) error) error {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	tx := &Tx{db: m}
+	defer func() {
+		tx.closed = true
+	}()
+	return fn(tx)
+}
+
+func (tx *Tx) check(write bool) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	if write && !tx.writable {
+		return ErrTxNotWritable
+	}
+	return nil
+}
+
+func (tx *Tx) Set(key, value []byte) (isNew bool, err error) {
+	err = tx.check(true)
+	if err != nil {
+		return
+	}
+	err = tx.db.checkParam(key, value)
+	if err != nil {
+		return
+	}
+
+	isNew, err = tx.db.tree.set(key, value)
+	return
+}
+
+func (tx *Tx) Delete(key []byte) error {
+	err := tx.check(true)
+	if err != nil {
+		return err
+	}
+
+	ok, err := tx.db.tree.delete(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRecordNotExist
+	}
+	return nil
+}
+
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	err := tx.check(false)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok, err := tx.db.tree.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRecordNotExist
+	}
+	return value, nil
+}
+
+// Range 按key从小到大返回[min, max]之间的记录
+func (tx *Tx) Range(min, max []byte) ([]KV, error) {
+	return tx.RangeWithOptions(min, max, RangeOptions{})
+}
+
+// Prefix 按key的顺序遍历所有以prefix开头的记录，fn返回false时停止遍历
+// 从prefix所在的叶子页开始沿着next遍历，遇到第一条不以prefix开头的记录就停止
+func (tx *Tx) Prefix(prefix []byte, fn func(key, value []byte) bool) error {
+	err := tx.check(false)
+	if err != nil {
+		return err
+	}
+
+	c := tx.Cursor()
+	for key, value := c.SeekPrefix(prefix); key != nil; key, value = c.Next() {
+		if !fn(key, value) {
+			break
+		}
+	}
+	return c.Err()
+}
@@ -0,0 +1,113 @@
+package mydb
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func newDefaultDB() *DB {
+	os.Remove("data")
+	os.Remove("data.wal")
+	db, err := Open("data")
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func TestUpdate(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_, _ = db.Set(toBytes(1), toBytes(100))
+
+	// 原子移动
+	err := db.Update(func(tx *Tx) error {
+		value, err := tx.Get(toBytes(1))
+		if err != nil {
+			return err
+		}
+		if err = tx.Delete(toBytes(1)); err != nil {
+			return err
+		}
+		_, err = tx.Set(toBytes(2), value)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Get(toBytes(1)); err != ErrRecordNotExist {
+		t.Fatal(err)
+	}
+	if value, _ := db.Get(toBytes(2)); string(value) != "100" {
+		t.Fatal(string(value))
+	}
+}
+
+func TestUpdate_rollback(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		_, _ = db.Set(toBytes(i), toBytes(i))
+	}
+	fileSize := db.tree.fm.fileSize()
+
+	// 大量写入导致页分裂，回滚后文件大小和数据都不变
+	errRollback := errors.New("rollback")
+	err := db.Update(func(tx *Tx) error {
+		for i := 100; i < 10000; i++ {
+			if _, err := tx.Set(toBytes(i), toBytes(i)); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < 100; i++ {
+			if err := tx.Delete(toBytes(i)); err != nil {
+				return err
+			}
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatal(err)
+	}
+
+	if db.tree.fm.fileSize() != fileSize {
+		t.Fatal(db.tree.fm.fileSize(), fileSize)
+	}
+	records, _ := db.Range(Infinity, Infinity)
+	if len(records) != 100 {
+		t.Fatal(len(records))
+	}
+	if _, err = db.Get(toBytes(5000)); err != ErrRecordNotExist {
+		t.Fatal(err)
+	}
+}
+
+func TestView(t *testing.T) {
+	db := newDefaultDB()
+	defer db.Close()
+
+	_, _ = db.Set(toBytes(1), toBytes(1))
+
+	var saved *Tx
+	err := db.View(func(tx *Tx) error {
+		saved = tx
+		if _, err := tx.Set(toBytes(2), toBytes(2)); err != ErrTxNotWritable {
+			t.Fatal(err)
+		}
+		value, err := tx.Get(toBytes(1))
+		if err != nil || string(value) != "1" {
+			t.Fatal(string(value), err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = saved.Get(toBytes(1)); err != ErrTxClosed {
+		t.Fatal(err)
+	}
+}
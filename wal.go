@@ -0,0 +1,242 @@
+package mydb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"syscall"
+)
+
+// walCheckpointSize wal超过这个大小后做一次检查点
+const walCheckpointSize = 4 << 20
+
+const walRecordHeaderLen = 8
+
+// walBufferSize 写入wal的缓冲大小
+const walBufferSize = 1 << 20
+
+// walContinued pageNum的最高位，表示事务还有后面的记录
+const walContinued = 1 << 31
+
+// walMaxBodyLen 一条记录body的最大长度，事务超过时拆分成多条记录
+var walMaxBodyLen int64 = math.MaxUint32
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+/**
+wal record 物理存储结构
+bodyLen    body的长度
+checksum   body的crc32c校验和
+fileSize   事务提交后的文件大小
+pageNum    页的数量，最高位是walContinued
+pages      offset(8字节)+页的完整内容，重复pageNum次
+
+事务的body超过walMaxBodyLen时拆分成多条记录，除了最后一条，pageNum都带有walContinued
+重放时只有读到最后一条记录，才会应用整个事务
+*/
+
+// wal 预写日志，记录每个事务修改后的页镜像，事务修改先落盘到wal，再应用到数据文件
+// 打开数据库时，重放wal中所有完整的记录，不完整的记录（写入一半时崩溃）会被丢弃
+type wal struct {
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+	noSync   bool // 追加记录时不刷盘，记录对应的页要等到sync之后才能写入数据文件
+	unsynced bool // 是否有还没有刷盘的记录
+}
+
+type walPage struct {
+	offset uint64
+	buf    []byte
+}
+
+func openWal(name string) (*wal, error) {
+	file, err := os.OpenFile(name, syscall.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &wal{file: file, size: info.Size()}, nil
+}
+
+// append 追加一个事务的记录，noSync为false时刷盘
+// 页直接写入文件，不会把整个事务复制到一个缓冲中
+func (w *wal) append(fileSize int64, pages []walPage) error {
+	if w.writer == nil {
+		w.writer = bufio.NewWriterSize(nil, walBufferSize)
+	}
+	out := &offsetWriter{file: w.file, offset: w.size}
+	w.writer.Reset(out)
+
+	for first := true; first || len(pages) > 0; first = false {
+		num, bodyLen := 0, int64(12)
+		for num < len(pages) && (num == 0 || bodyLen+byte8+int64(len(pages[num].buf)) <= walMaxBodyLen) {
+			bodyLen += byte8 + int64(len(pages[num].buf))
+			num++
+		}
+		if bodyLen > walMaxBodyLen {
+			return ErrRecordTooLarge
+		}
+
+		err := w._writeRecord(fileSize, pages[:num], bodyLen, num < len(pages))
+		if err != nil {
+			return err
+		}
+		pages = pages[num:]
+	}
+	err := w.writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	if w.noSync {
+		w.unsynced = true
+	} else {
+		err = w.file.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	w.size = out.offset
+	return nil
+}
+
+// _writeRecord 先计算校验和，再依次写入记录头和页
+func (w *wal) _writeRecord(fileSize int64, pages []walPage, bodyLen int64, continued bool) error {
+	pageNum := uint32(len(pages))
+	if continued {
+		pageNum |= walContinued
+	}
+	head := make([]byte, walRecordHeaderLen+12)
+	binary.BigEndian.PutUint64(head[walRecordHeaderLen:], uint64(fileSize))
+	binary.BigEndian.PutUint32(head[walRecordHeaderLen+8:], pageNum)
+
+	offsetBuf := make([]byte, byte8)
+	checksum := crc32.Update(0, crcTable, head[walRecordHeaderLen:])
+	for _, p := range pages {
+		binary.BigEndian.PutUint64(offsetBuf, p.offset)
+		checksum = crc32.Update(checksum, crcTable, offsetBuf)
+		checksum = crc32.Update(checksum, crcTable, p.buf)
+	}
+	binary.BigEndian.PutUint32(head, uint32(bodyLen))
+	binary.BigEndian.PutUint32(head[4:], checksum)
+
+	_, err := w.writer.Write(head)
+	if err != nil {
+		return err
+	}
+	for _, p := range pages {
+		binary.BigEndian.PutUint64(offsetBuf, p.offset)
+		if _, err = w.writer.Write(offsetBuf); err != nil {
+			return err
+		}
+		if _, err = w.writer.Write(p.buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// offsetWriter 从offset开始顺序写入文件
+type offsetWriter struct {
+	file   *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// sync 将已经追加的记录刷盘
+func (w *wal) sync() error {
+	if !w.unsynced {
+		return nil
+	}
+	err := w.file.Sync()
+	if err != nil {
+		return err
+	}
+	w.unsynced = false
+	return nil
+}
+
+// replay 按顺序读取所有完整的事务，遇到不完整或者校验失败的记录停止
+func (w *wal) replay(fn func(fileSize int64, pages []walPage) error) error {
+	var offset int64
+	var txPages []walPage // 事务中已经读取的记录的页
+	header := make([]byte, walRecordHeaderLen)
+	for offset+walRecordHeaderLen <= w.size {
+		_, err := w.file.ReadAt(header, offset)
+		if err != nil {
+			return err
+		}
+		bodyLen := int64(binary.BigEndian.Uint32(header))
+		checksum := binary.BigEndian.Uint32(header[4:])
+		if bodyLen < 12 || offset+walRecordHeaderLen+bodyLen > w.size {
+			return nil
+		}
+
+		body := make([]byte, bodyLen)
+		_, err = w.file.ReadAt(body, offset+walRecordHeaderLen)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if crc32.Checksum(body, crcTable) != checksum {
+			return nil
+		}
+
+		fileSize := int64(binary.BigEndian.Uint64(body))
+		pageNum := binary.BigEndian.Uint32(body[8:])
+		continued := pageNum&walContinued != 0
+		pageNum &^= walContinued
+		pageSize := 0
+		if pageNum > 0 {
+			pageSize = (len(body)-12)/int(pageNum) - byte8
+		}
+		index := 12
+		for i := uint32(0); i < pageNum; i++ {
+			txPages = append(txPages, walPage{
+				offset: binary.BigEndian.Uint64(body[index:]),
+				buf:    body[index+byte8 : index+byte8+pageSize],
+			})
+			index += byte8 + pageSize
+		}
+
+		offset += walRecordHeaderLen + bodyLen
+		if continued {
+			continue
+		}
+
+		err = fn(fileSize, txPages)
+		if err != nil {
+			return err
+		}
+		txPages = nil
+	}
+	return nil
+}
+
+// reset 清空wal，只有在数据文件已经刷盘之后才能调用
+func (w *wal) reset() error {
+	err := w.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	w.size = 0
+	w.unsynced = false
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
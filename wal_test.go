@@ -0,0 +1,157 @@
+package mydb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func Test_wal_replay(t *testing.T) {
+	name := "data.txt.wal"
+	os.Remove(name)
+	w, err := openWal(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	page1 := bytes.Repeat([]byte{1}, defaultPageSize)
+	page2 := bytes.Repeat([]byte{2}, defaultPageSize)
+	if err = w.append(defaultPageSize*2, []walPage{{offset: 0, buf: page1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.append(defaultPageSize*3, []walPage{{offset: 0, buf: page2}, {offset: defaultPageSize, buf: page1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟写入一半时崩溃
+	_, _ = w.file.WriteAt([]byte{0, 0, 1, 0, 1, 2}, w.size)
+	w.size += 6
+
+	var sizes []int64
+	err = w.replay(func(fileSize int64, pages []walPage) error {
+		sizes = append(sizes, fileSize)
+		if fileSize == defaultPageSize*3 && (len(pages) != 2 || !bytes.Equal(pages[1].buf, page1)) {
+			t.Fatal(pages)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 {
+		t.Fatal(sizes)
+	}
+}
+
+func Test_wal_replay_split(t *testing.T) {
+	defer func(n int64) { walMaxBodyLen = n }(walMaxBodyLen)
+	walMaxBodyLen = 12 + 3*(byte8+defaultPageSize)
+
+	name := "data.txt.wal"
+	os.Remove(name)
+	w, err := openWal(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	var pages []walPage
+	for i := 0; i < 10; i++ {
+		pages = append(pages, walPage{offset: uint64(i) * defaultPageSize, buf: bytes.Repeat([]byte{byte(i)}, defaultPageSize)})
+	}
+	if err = w.append(defaultPageSize*10, pages); err != nil {
+		t.Fatal(err)
+	}
+	// 拆分成4条记录
+	if w.size != 4*(walRecordHeaderLen+12)+10*(byte8+defaultPageSize) {
+		t.Fatal(w.size)
+	}
+	if err = w.append(defaultPageSize*11, pages[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟最后一条记录写入一半时崩溃，整个事务都不重放
+	if err = w.append(defaultPageSize*12, pages); err != nil {
+		t.Fatal(err)
+	}
+	w.size -= 10
+
+	var sizes []int64
+	err = w.replay(func(fileSize int64, replayed []walPage) error {
+		sizes = append(sizes, fileSize)
+		if fileSize == defaultPageSize*10 {
+			if len(replayed) != len(pages) {
+				t.Fatal(len(replayed))
+			}
+			for i := range pages {
+				if replayed[i].offset != pages[i].offset || !bytes.Equal(replayed[i].buf, pages[i].buf) {
+					t.Fatal(i)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 || sizes[1] != defaultPageSize*11 {
+		t.Fatal(sizes)
+	}
+}
+
+// crashFileManager 不做检查点直接关闭，模拟进程崩溃
+func crashFileManager(fm *fileManager) {
+	_ = fm.release()
+}
+
+func Test_fileManager_recover(t *testing.T) {
+	name := "data.txt"
+	os.Remove(name)
+	os.Remove(name + ".wal")
+	fm, err := newFileManager(name, getOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := newTree(fm)
+
+	// 已经写入wal，但是没有应用到数据文件的事务
+	fm.begin()
+	for i := 0; i < 1000; i++ {
+		tree.set(toBytes(i), toBytes(i))
+	}
+	tx := fm.tx
+	fm.tx = nil
+	err = fm.truncate(tx.size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fm.wal.append(tx.size, tx.dirtyPages(fm))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有写入wal的事务
+	fm.begin()
+	tree.set(toBytes(2000), toBytes(2000))
+	fm.tx = nil
+
+	crashFileManager(fm)
+
+	fm, err = newFileManager(name, getOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.close()
+	tree = newTree(fm)
+
+	if fm.wal.size != 0 {
+		t.Fatal(fm.wal.size)
+	}
+	if num, _ := tree.count(); num != 1000 {
+		t.Fatal(num)
+	}
+	if _, ok, _ := tree.get(toBytes(2000)); ok {
+		t.Fatal()
+	}
+}